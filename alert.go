@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"cometbft-peer-filter/peerfilter"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// postAlerts sends alerts to a webhook as a JSON array.
+func postAlerts(url string, alerts []peerfilter.SLAAlert, timeout time.Duration) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
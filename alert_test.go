@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSLAWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var posts [][]peerfilter.SLAAlert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		var alerts []peerfilter.SLAAlert
+		if err := json.Unmarshal(body, &alerts); err != nil {
+			t.Errorf("webhook body %q: %v", body, err)
+		}
+		mu.Lock()
+		posts = append(posts, alerts)
+		mu.Unlock()
+	}))
+	t.Cleanup(hook.Close)
+
+	// Every peer moves 200 B/s, below the SLA.
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)),
+		"-sla-min-rate", "300", "-sla-intervals", "2", "-sla-webhook", hook.URL)
+	for range 3 {
+		if err := run(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 1 {
+		t.Fatalf("webhook got %d posts over 3 runs, want 1 on the second run", len(posts))
+	}
+	alerts := posts[0]
+	if len(alerts) != 2 {
+		t.Fatalf("webhook got %d alerts, want 2", len(alerts))
+	}
+	for i, a := range alerts {
+		id, addr, _ := strings.Cut(testPeerEntry(i+1), "@")
+		want := peerfilter.SLAAlert{
+			NodeID:    id,
+			Moniker:   fmt.Sprintf("peer-%d", i+1),
+			Address:   addr,
+			Reason:    "rate 200 B/s below 300 B/s",
+			Intervals: 2,
+		}
+		if a != want {
+			t.Errorf("alert %d = %+v, want %+v", i, a, want)
+		}
+	}
+}
+
+func TestPostAlertsStatus(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(hook.Close)
+	if err := postAlerts(hook.URL, []peerfilter.SLAAlert{{NodeID: "a"}}, 0); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("postAlerts to a failing webhook: err = %v, want the 503 status", err)
+	}
+}
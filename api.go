@@ -0,0 +1,117 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// apiServer serves the latest selection of a daemon over HTTP: GET /peers
+// returns it and POST /refresh runs a selection at once and returns that.
+// GET /metrics serves peerfilter.Registry for Prometheus to scrape.
+type apiServer struct {
+	// addr is the bound address, with any port 0 resolved.
+	addr string
+
+	// refresh passes each /refresh request to the daemon loop, which
+	// replies with the run's error once it is done.
+	refresh chan chan error
+
+	mu        sync.Mutex
+	peers     []peerfilter.PeerRecord
+	fetchedAt time.Time
+}
+
+// apiSelection is the JSON body of /peers and /refresh.
+type apiSelection struct {
+	FetchedAt time.Time               `json:"fetched_at"`
+	Peers     []peerfilter.PeerRecord `json:"peers"`
+}
+
+// serveAPI starts an apiServer listening on addr. It only returns once
+// the listener is bound, so a bad address fails at startup.
+func serveAPI(addr string) (*apiServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+	s := &apiServer{addr: ln.Addr().String(), refresh: make(chan chan error)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/peers", s.handlePeers)
+	mux.HandleFunc("/refresh", s.handleRefresh)
+	mux.Handle("/metrics", promhttp.HandlerFor(peerfilter.Registry, promhttp.HandlerOpts{}))
+	go func() {
+		log.Errorf("Stopped serving the API on %s: %v", addr, http.Serve(ln, mux))
+	}()
+	log.Infof("Serving the API on %s", s.addr)
+	return s, nil
+}
+
+// update records the selection of a completed run.
+func (s *apiServer) update(res *peerfilter.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers = res.Peers
+	s.fetchedAt = res.Metadata.FetchedAt.UTC()
+}
+
+func (s *apiServer) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeSelection(w)
+}
+
+func (s *apiServer) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	done := make(chan error, 1)
+	select {
+	case s.refresh <- done:
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	case <-r.Context().Done():
+		return
+	}
+	s.writeSelection(w)
+}
+
+// writeSelection writes the latest selection as JSON, or 503 Service
+// Unavailable before the first run has completed.
+func (s *apiServer) writeSelection(w http.ResponseWriter) {
+	s.mu.Lock()
+	sel := apiSelection{FetchedAt: s.fetchedAt, Peers: s.peers}
+	s.mu.Unlock()
+	if sel.FetchedAt.IsZero() {
+		http.Error(w, "no selection yet", http.StatusServiceUnavailable)
+		return
+	}
+	if sel.Peers == nil {
+		sel.Peers = []peerfilter.PeerRecord{}
+	}
+	out, err := json.MarshalIndent(sel, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(out, '\n'))
+}
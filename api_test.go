@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getSelection decodes the selection returned by a request to the API.
+func getSelection(t *testing.T, method, url string) (apiSelection, int) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var sel apiSelection
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&sel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sel, resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	url, _ := serveGrowingNetInfo(t)
+
+	opts := testOptions(t, "-host", url, "-interval", "1h", "-listen", "127.0.0.1:0")
+	api, err := serveAPI(opts.listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.api = api
+	base := "http://" + api.addr
+	if _, status := getSelection(t, http.MethodGet, base+"/peers"); status != http.StatusServiceUnavailable {
+		t.Errorf("GET /peers before the first run: status %d, want 503", status)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDaemon(opts, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var sel apiSelection
+	for status := 0; status != http.StatusOK; {
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /peers: status %d after the first run, want 200", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		sel, status = getSelection(t, http.MethodGet, base+"/peers")
+	}
+	if len(sel.Peers) != 1 || sel.FetchedAt.IsZero() {
+		t.Errorf("GET /peers = %d peers fetched at %s, want 1 peer with a fetch time", len(sel.Peers), sel.FetchedAt)
+	}
+
+	// The interval is an hour away, so only the refresh fetches again.
+	sel, status := getSelection(t, http.MethodPost, base+"/refresh")
+	if status != http.StatusOK || len(sel.Peers) != 2 {
+		t.Fatalf("POST /refresh: status %d with %d peers, want 200 with 2", status, len(sel.Peers))
+	}
+	if sel, _ := getSelection(t, http.MethodGet, base+"/peers"); len(sel.Peers) != 2 {
+		t.Errorf("GET /peers after a refresh = %d peers, want 2", len(sel.Peers))
+	}
+
+	resp, err := http.Get(base + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `peer_filter_peer_version_count{network="testnet-1",version="0.38.12"} 2`
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(metrics), want) {
+		t.Errorf("GET /metrics: status %d, want 200 with %q in:\n%s", resp.StatusCode, want, metrics)
+	}
+
+	if _, status := getSelection(t, http.MethodGet, base+"/refresh"); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /refresh: status %d, want 405", status)
+	}
+	if _, status := getSelection(t, http.MethodPost, base+"/peers"); status != http.StatusMethodNotAllowed {
+		t.Errorf("POST /peers: status %d, want 405", status)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandArgsFiles replaces each @file argument in args with the arguments
+// listed in file, one per line. A line holding a flag and its value
+// separated by whitespace, e.g. "-host http://a:26657", yields both.
+// Blank lines and lines starting with # are skipped, and @file lines
+// inside a file are not expanded again. Only arguments in flag position
+// are expanded, so values such as -sybil-patterns @file are left alone.
+func expandArgsFiles(fset *flag.FlagSet, args []string) ([]string, error) {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(out, args[i:]...), nil
+		}
+		if path, ok := strings.CutPrefix(arg, "@"); ok {
+			lines, err := readArgsFile(path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, lines...)
+			continue
+		}
+		out = append(out, arg)
+		if takesValue(fset, arg) && i+1 < len(args) {
+			i++
+			out = append(out, args[i])
+		}
+	}
+	return out, nil
+}
+
+// takesValue reports whether arg is a flag whose value is the next
+// argument: a non-boolean flag given without =value.
+func takesValue(fset *flag.FlagSet, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if name == arg || strings.Contains(name, "=") {
+		return false
+	}
+	f := fset.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// readArgsFile returns the arguments listed in the response file path.
+func readArgsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading arguments from %s: %w", path, err)
+	}
+	var args []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexAny(line, " \t"); strings.HasPrefix(line, "-") && i > 0 && !strings.Contains(line[:i], "=") {
+			args = append(args, line[:i], strings.TrimSpace(line[i:]))
+			continue
+		}
+		args = append(args, line)
+	}
+	return args, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandArgsFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "args")
+	lines := "# selection\n-host http://a:26657,http://b:26657\n\n  -top=3\n-drop-zero-bytes\n@nested\n"
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("host", "", "")
+	fs.String("sybil-patterns", "", "")
+	fs.Bool("drop-zero-bytes", false, "")
+	got, err := expandArgsFiles(fs, []string{"-drop-zero-bytes", "@" + path, "-sybil-patterns", "@patterns", "--", "@after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-drop-zero-bytes",
+		"-host", "http://a:26657,http://b:26657", "-top=3", "-drop-zero-bytes", "@nested",
+		"-sybil-patterns", "@patterns",
+		"--", "@after",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expanded to %q, want %q", got, want)
+	}
+
+	if _, err := expandArgsFiles(fs, []string{"@" + filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expanding a missing file succeeded")
+	}
+}
+
+func TestArgsFileFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "args")
+	if err := os.WriteFile(path, []byte("-host http://a:26657\n-top 3\n-drop-zero-bytes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Later arguments still override the file.
+	o, err := parseFlags([]string{"@" + path, "-top", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(o.Hosts, []string{"http://a:26657"}) || o.TopPeers != 5 || !o.DropZeroBytes {
+		t.Errorf("options from the args file: hosts %v, top %d, drop-zero-bytes %v; want http://a:26657, 5 and true", o.Hosts, o.TopPeers, o.DropZeroBytes)
+	}
+}
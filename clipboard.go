@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/atotto/clipboard"
+	log "github.com/sirupsen/logrus"
+)
+
+// The system clipboard, replaced in tests.
+var (
+	clipboardUnsupported = clipboard.Unsupported
+	writeClipboard       = clipboard.WriteAll
+)
+
+// copyToClipboard puts output on the system clipboard. Without a
+// clipboard, e.g. on a headless host, it only logs a warning.
+func copyToClipboard(output string) {
+	if clipboardUnsupported {
+		log.Warn("No clipboard available (xclip, xsel or wl-copy is needed on Linux), not copying the output")
+		return
+	}
+	if err := writeClipboard(output); err != nil {
+		log.Warnf("Error copying the output to the clipboard: %v", err)
+		return
+	}
+	log.Info("Copied the output to the clipboard")
+}
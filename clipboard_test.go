@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"strings"
+	"testing"
+)
+
+// mockClipboard replaces the system clipboard for the test and returns
+// what was last copied to it.
+func mockClipboard(t *testing.T, unsupported bool, err error) *string {
+	t.Helper()
+	prevUnsupported, prevWrite := clipboardUnsupported, writeClipboard
+	t.Cleanup(func() { clipboardUnsupported, writeClipboard = prevUnsupported, prevWrite })
+	copied := new(string)
+	clipboardUnsupported = unsupported
+	writeClipboard = func(s string) error {
+		*copied = s
+		return err
+	}
+	return copied
+}
+
+func TestClipboard(t *testing.T) {
+	copied := mockClipboard(t, false, nil)
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)), "-output-file", "", "-clipboard")
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := testPeerEntry(1) + "," + testPeerEntry(2); *copied != want {
+		t.Errorf("copied %q to the clipboard, want %q", *copied, want)
+	}
+}
+
+func TestClipboardUnavailable(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	copied := mockClipboard(t, true, nil)
+	copyToClipboard("output")
+	if *copied != "" {
+		t.Errorf("copied %q without a clipboard", *copied)
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "No clipboard available") {
+		t.Errorf("last log entry %v, want a warning that there is no clipboard", e)
+	}
+
+	mockClipboard(t, false, errors.New("no display"))
+	copyToClipboard("output")
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "no display") {
+		t.Errorf("last log entry %v, want the clipboard error", e)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// runDaemon runs every opts.interval until stop is closed, or until the
+// process exits if stop is nil. With
+// -settings-dir, changes to the directory reload the settings; the next
+// run uses them. Settings that fail to parse or validate are logged and
+// the previous ones are kept. With -listen, which main has started as
+// opts.api, POST /refresh runs at once and restarts the interval.
+func runDaemon(opts options, stop <-chan struct{}) {
+	var refresh chan chan error
+	if opts.api != nil {
+		refresh = opts.api.refresh
+	}
+
+	reloaded := make(chan options)
+	if opts.settingsDir != "" {
+		go func() {
+			err := watchDir(opts.settingsDir, opts.watchDebounce, func() {
+				o, err := loadOptions(opts.args)
+				if err != nil {
+					log.Errorf("Keeping previous settings, reload from %s failed: %v", opts.settingsDir, err)
+					return
+				}
+				select {
+				case reloaded <- o:
+				case <-stop:
+				}
+			})
+			log.Errorf("Stopped watching %s for settings changes: %v", opts.settingsDir, err)
+		}()
+	}
+
+	// With -once-and-watch, main has already made the first run.
+	skip := opts.onceAndWatch
+	var refreshed chan error
+	for {
+		if !skip {
+			err := run(opts)
+			if err != nil {
+				log.Error(err)
+			}
+			if refreshed != nil {
+				refreshed <- err
+				refreshed = nil
+			}
+		}
+		skip = false
+		wait := time.After(opts.interval)
+	waiting:
+		for {
+			select {
+			case <-stop:
+				return
+			case <-wait:
+				break waiting
+			case refreshed = <-refresh:
+				log.Info("Refreshing on API request")
+				break waiting
+			case o := <-reloaded:
+				if o.interval <= 0 {
+					log.Errorf("Keeping previous settings, reload from %s disables -interval", opts.settingsDir)
+					continue
+				}
+				opts = keepState(opts, o)
+				log.Infof("Reloaded settings from %s", opts.settingsDir)
+			}
+		}
+	}
+}
+
+// keepState returns next with the state of prev carried over, so a reload
+// does not reset hysteresis, deltas, rate histories or SLA counts,
+// refetch the denylist, restart the warmup, move the -deadline or rebind
+// the -listen API.
+func keepState(prev, next options) options {
+	next.warmupUntil = prev.warmupUntil
+	next.deadline = prev.deadline
+	next.api = prev.api
+	if prev.Hysteresis != nil && next.Hysteresis != nil {
+		prev.Hysteresis.Margin = next.Hysteresis.Margin
+		prev.Hysteresis.Intervals = next.Hysteresis.Intervals
+		next.Hysteresis = prev.Hysteresis
+	}
+	if prev.Denylist != nil && next.Denylist != nil && prev.Denylist.URL == next.Denylist.URL {
+		prev.Denylist.TTL = next.Denylist.TTL
+		next.Denylist = prev.Denylist
+	}
+	if prev.Deltas != nil && next.Deltas != nil {
+		next.Deltas = prev.Deltas
+	}
+	if prev.Stability != nil && next.Stability != nil {
+		prev.Stability.Window = next.Stability.Window
+		prev.Stability.Kernel = next.Stability.Kernel
+		next.Stability = prev.Stability
+	}
+	if prev.SLA != nil && next.SLA != nil {
+		prev.SLA.MinRate = next.SLA.MinRate
+		prev.SLA.MaxIdle = next.SLA.MaxIdle
+		prev.SLA.Intervals = next.SLA.Intervals
+		next.SLA = prev.SLA
+	}
+	return next
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForFile polls path until it holds want, failing the test after a
+// few seconds.
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil && string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, want %q", path, data, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunDaemonReloadsSettings(t *testing.T) {
+	dir := t.TempDir()
+	writeSettings(t, dir, map[string]string{"top": "1"})
+	out := filepath.Join(t.TempDir(), "peers.txt")
+	opts, err := loadOptions([]string{
+		"-host", serveNetInfo(t, testPeers(3)),
+		"-settings-dir", dir,
+		"-interval", "20ms",
+		"-watch-debounce", "10ms",
+		"-output-file", out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDaemon(opts, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	waitForFile(t, out, testPeerEntry(1))
+	writeSettings(t, dir, map[string]string{"top": "2"})
+	two := strings.Join([]string{testPeerEntry(1), testPeerEntry(2)}, ",")
+	waitForFile(t, out, two)
+
+	// A setting that fails to parse keeps the previous ones.
+	writeSettings(t, dir, map[string]string{"top": "three"})
+	time.Sleep(200 * time.Millisecond)
+	waitForFile(t, out, two)
+}
+
+// startWatching runs runWatching with opts in the background until the
+// test ends.
+func startWatching(t *testing.T, opts options) {
+	t.Helper()
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- runWatching(opts, stop) }()
+	t.Cleanup(func() {
+		close(stop)
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestOnceAndWatchWritesDuringWarmup(t *testing.T) {
+	url, fetches := serveGrowingNetInfo(t)
+	opts := testOptions(t, "-host", url, "-interval", "1h", "-warmup", "1h", "-once-and-watch")
+	startWatching(t, opts)
+	waitForFile(t, opts.outputFile, testPeerEntry(1))
+	// The daemon does not repeat the first run.
+	time.Sleep(100 * time.Millisecond)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d fetches within the first interval, want 1", n)
+	}
+}
+
+func TestWarmupWithoutOnceAndWatch(t *testing.T) {
+	url, fetches := serveGrowingNetInfo(t)
+	opts := testOptions(t, "-host", url, "-interval", "1h", "-warmup", "1h")
+	startWatching(t, opts)
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(opts.outputFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the first run during the warmup wrote %s (stat error %v)", opts.outputFile, err)
+	}
+}
+
+func TestOnceAndWatchInterval(t *testing.T) {
+	url, _ := serveGrowingNetInfo(t)
+	opts := testOptions(t, "-host", url, "-interval", "50ms", "-once-and-watch")
+	startWatching(t, opts)
+	waitForFile(t, opts.outputFile, testPeerEntry(1))
+	// Each interval fetches again, and the stub reports one more peer.
+	waitForFile(t, opts.outputFile, strings.Join([]string{testPeerEntry(1), testPeerEntry(2), testPeerEntry(3)}, ","))
+}
+
+func TestOnceAndWatchFirstRunFails(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	opts := testOptions(t, "-host", srv.URL, "-interval", "50ms", "-once-and-watch")
+	done := make(chan error, 1)
+	go func() { done <- runWatching(opts, nil) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("runWatching returned no error for a failed first run")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runWatching kept running after the first run failed")
+	}
+}
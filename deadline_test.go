@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if _, err := loadOptions([]string{"-deadline", past}); err == nil || !strings.Contains(err.Error(), "already passed") {
+		t.Errorf("a past -deadline: err = %v, want it to abort at startup", err)
+	}
+	if _, err := parseFlags([]string{"-deadline", "tomorrow"}); err == nil {
+		t.Error("an invalid -deadline was accepted")
+	}
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(1)), "-deadline", future)
+	if err := run(opts); err != nil {
+		t.Fatalf("run with a future -deadline: %v", err)
+	}
+	if data, err := os.ReadFile(opts.outputFile); err != nil || string(data) != testPeerEntry(1) {
+		t.Errorf("run with a future -deadline wrote %q (error %v), want %q", data, err, testPeerEntry(1))
+	}
+}
+
+func TestDeadlineAbortsRun(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	opts := testOptions(t, "-host", slow.URL, "-timeout", "30s")
+	// The flag only takes whole seconds, so set a closer deadline here.
+	opts.deadline = time.Now().Add(100 * time.Millisecond)
+	start := time.Now()
+	if err := run(opts); err == nil {
+		t.Fatal("a run past its -deadline succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the run took %s to abort, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// exitPermissionDenied is the exit status used when an output file cannot
+// be written because of file system permissions.
+const exitPermissionDenied = 3
+
+// exitStatus returns the exit status for a run failing with err:
+// exitPermissionDenied for a *permissionError, 1 otherwise.
+func exitStatus(err error) int {
+	var permErr *permissionError
+	if errors.As(err, &permErr) {
+		return exitPermissionDenied
+	}
+	return 1
+}
+
+// permissionError reports that an output file could not be written
+// because of file system permissions.
+type permissionError struct {
+	path string // absolute path of the file
+	err  error
+}
+
+func (e *permissionError) Error() string {
+	return fmt.Sprintf("permission denied writing %s: make %s writable by this user or run from a writable directory (%v)",
+		e.path, filepath.Dir(e.path), e.err)
+}
+
+func (e *permissionError) Unwrap() error { return e.err }
+
+// wrapWriteError turns a permission failure writing path into a
+// *permissionError and wraps any other failure with what was being written.
+func wrapWriteError(what, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		abs, absErr := filepath.Abs(path)
+		if absErr != nil {
+			abs = path
+		}
+		return &permissionError{path: abs, err: err}
+	}
+	return fmt.Errorf("error writing %s: %w", what, err)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)), "-output-file", filepath.Join(dir, "peers.txt"))
+	err := run(opts)
+	var permErr *permissionError
+	if !errors.As(err, &permErr) {
+		t.Fatalf("writing to a read-only directory: err = %v, want a permission error", err)
+	}
+	if got := exitStatus(err); got != exitPermissionDenied {
+		t.Errorf("exit status %d, want %d", got, exitPermissionDenied)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	err := wrapWriteError("result file", "peers.txt", &fs.PathError{Op: "open", Path: "peers.txt", Err: fs.ErrPermission})
+	if got := exitStatus(err); got != exitPermissionDenied {
+		t.Errorf("exit status for %v = %d, want %d", err, got, exitPermissionDenied)
+	}
+	err = wrapWriteError("result file", "peers.txt", errors.New("disk full"))
+	if got := exitStatus(err); got != 1 {
+		t.Errorf("exit status for %v = %d, want 1", err, got)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"time"
+)
+
+// writeEtcd stores value under key on the comma-separated etcd endpoints.
+func writeEtcd(endpoints, key, value string, timeout time.Duration) error {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: timeout,
+	})
+	if err != nil {
+		return fmt.Errorf("error connecting to etcd %s: %w", endpoints, err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := cli.Put(ctx, key, value); err != nil {
+		return fmt.Errorf("error writing etcd key %s: %w", key, err)
+	}
+	return nil
+}
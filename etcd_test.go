@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKV is an etcd KV service that records the Put requests it receives.
+type fakeKV struct {
+	pb.UnimplementedKVServer
+	mu   sync.Mutex
+	puts []*pb.PutRequest
+}
+
+func (kv *fakeKV) Put(_ context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.puts = append(kv.puts, req)
+	return &pb.PutResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+func TestWriteEtcd(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := &fakeKV{}
+	srv := grpc.NewServer()
+	pb.RegisterKVServer(srv, kv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	if err := writeEtcd(lis.Addr().String(), "/cometbft/peers", "id@10.0.0.1:26656", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.puts) != 1 {
+		t.Fatalf("etcd received %d puts, want 1", len(kv.puts))
+	}
+	if got := kv.puts[0]; string(got.Key) != "/cometbft/peers" || string(got.Value) != "id@10.0.0.1:26656" {
+		t.Errorf("put %q = %q, want the key and output", got.Key, got.Value)
+	}
+}
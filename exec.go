@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runExec runs command through the shell with output on its stdin and
+// logs its exit status. The command's own stdout and stderr go to ours.
+func runExec(command, output string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		log.Infof("Exec hook %q exited with status 0", command)
+		return nil
+	case errors.As(err, &exitErr):
+		if ctx.Err() != nil {
+			return fmt.Errorf("error running exec hook %q: timed out after %s", command, timeout)
+		}
+		log.Warnf("Exec hook %q exited with status %d", command, exitErr.ExitCode())
+		return fmt.Errorf("exec hook %q failed: %w", command, err)
+	default:
+		return fmt.Errorf("error running exec hook %q: %w", command, err)
+	}
+}
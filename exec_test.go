@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus/hooks/test"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunExec(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	path := filepath.Join(t.TempDir(), "received")
+	output := "aaaa@10.0.0.1:26656,bbbb@10.0.0.2:26656\n"
+	if err := runExec("cat > "+path, output, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != output {
+		t.Errorf("exec hook received %q, want %q", got, output)
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "exited with status 0") {
+		t.Errorf("last log entry %v, want the exit status", e)
+	}
+
+	if err := runExec("exit 3", output, 5*time.Second); err == nil {
+		t.Error("a failing exec hook returned no error")
+	} else if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "exited with status 3") {
+		t.Errorf("last log entry %v, want exit status 3", e)
+	}
+	if err := runExec("exec sleep 5", output, 50*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow exec hook: err = %v, want a timeout", err)
+	}
+}
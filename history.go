@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"database/sql"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"strings"
+	"time"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	fetched_at     TEXT    NOT NULL,
+	hosts          TEXT    NOT NULL,
+	sort_by        TEXT    NOT NULL,
+	total_peers    INTEGER NOT NULL,
+	passed_peers   INTEGER NOT NULL,
+	selected_peers INTEGER NOT NULL,
+	total_bytes    INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS selected_peers (
+	run_id      INTEGER NOT NULL REFERENCES runs(id),
+	rank        INTEGER NOT NULL,
+	node_id     TEXT    NOT NULL,
+	moniker     TEXT    NOT NULL,
+	address     TEXT    NOT NULL,
+	network     TEXT    NOT NULL,
+	total_bytes INTEGER NOT NULL,
+	PRIMARY KEY (run_id, rank)
+);
+CREATE INDEX IF NOT EXISTS selected_peers_node_id ON selected_peers(node_id);
+`
+
+// recordHistory appends the run in res and its selected peers to the
+// SQLite database at path, creating the schema if needed.
+func recordHistory(path string, res *peerfilter.Result) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("error opening history database %s: %w", path, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(historySchema); err != nil {
+		return fmt.Errorf("error creating history schema in %s: %w", path, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting history transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	agg := res.Aggregates
+	run, err := tx.Exec(`INSERT INTO runs (fetched_at, hosts, sort_by, total_peers, passed_peers, selected_peers, total_bytes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		res.Metadata.FetchedAt.UTC().Format(time.RFC3339Nano),
+		strings.Join(res.Metadata.Hosts, ","),
+		res.Metadata.SortBy,
+		agg.TotalPeers, agg.PassedPeers, agg.SelectedPeers, agg.TotalBytes,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+	runID, err := run.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+
+	for _, p := range res.Peers {
+		if _, err := tx.Exec(`INSERT INTO selected_peers (run_id, rank, node_id, moniker, address, network, total_bytes)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			runID, p.Rank, p.NodeID, p.Moniker, p.Address, p.Network, p.TotalBytes,
+		); err != nil {
+			return fmt.Errorf("error recording peer %s: %w", p.NodeID, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestRecordHistory(t *testing.T) {
+	// A shared in-memory database lives as long as one connection to it
+	// is open, so db keeps it alive across recordHistory's own connection.
+	const path = "file:history_test?mode=memory&cache=shared"
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	host := serveNetInfo(t, testPeers(3))
+	res, err := peerfilter.SelectTopPeers(context.Background(), peerfilter.Options{Hosts: []string{host}, TopPeers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := recordHistory(path, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var runs, total, selected int
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(total_peers), MAX(selected_peers) FROM runs`).Scan(&runs, &total, &selected); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 || total != 3 || selected != 2 {
+		t.Errorf("runs table holds %d runs of %d peers with %d selected, want 2 runs of 3 with 2", runs, total, selected)
+	}
+	rows, err := db.Query(`SELECT moniker FROM selected_peers WHERE run_id = 2 ORDER BY rank`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var moniker string
+		if err := rows.Scan(&moniker); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, moniker)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "peer-1" || got[1] != "peer-2" {
+		t.Errorf("second run selected %v, want peer-1 and peer-2", got)
+	}
+}
+
+func TestRecordHistoryRank(t *testing.T) {
+	const path = "file:history_rank_test?mode=memory&cache=shared"
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output is shuffled, but the stored rank is the peer's rank.
+	host := serveNetInfo(t, testPeers(5))
+	res, err := peerfilter.SelectTopPeers(context.Background(), peerfilter.Options{Hosts: []string{host}, TopPeers: 5, Shuffle: true, ShuffleSeed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Peers[0].Moniker == "peer-1" {
+		t.Fatal("seed 7 kept peer-1 first; pick another seed")
+	}
+	if err := recordHistory(path, res); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(`SELECT rank, moniker FROM selected_peers`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var rank int
+		var moniker string
+		if err := rows.Scan(&rank, &moniker); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("peer-%d", rank); moniker != want {
+			t.Errorf("%s stored with rank %d, want %s there", moniker, rank, want)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("%d peers stored, want 5", n)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// acquireLock takes an exclusive flock on path, creating the file if
+// needed, and records our PID in it. If another process holds the lock it
+// returns ok false and that process's PID, if recorded. release unlocks
+// the file, which is left in place so the next run can lock it again.
+func acquireLock(path string) (release func(), ok bool, holder string, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, "", wrapWriteError("lockfile", path, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		data, _ := os.ReadFile(path)
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, strings.TrimSpace(string(data)), nil
+		}
+		return nil, false, "", fmt.Errorf("error locking %s: %w", path, err)
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, true, "", nil
+}
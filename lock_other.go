@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// acquireLock is unavailable on platforms without flock.
+func acquireLock(path string) (release func(), ok bool, holder string, err error) {
+	return nil, false, "", errors.New("-lockfile is not supported on this platform")
+}
@@ -0,0 +1,57 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLockfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peer-filter.lock")
+	release, ok, _, err := acquireLock(path)
+	if err != nil || !ok {
+		t.Fatalf("first acquireLock: ok %v, err %v", ok, err)
+	}
+
+	_, ok, holder, err := acquireLock(path)
+	if err != nil || ok {
+		t.Fatalf("second acquireLock while the first holds the lock: ok %v, err %v, want refused", ok, err)
+	}
+	if want := strconv.Itoa(os.Getpid()); holder != want {
+		t.Errorf("lock holder %q, want our PID %s", holder, want)
+	}
+
+	// A run that finds the lock held writes nothing.
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(1)), "-lockfile", path)
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(opts.outputFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a run without the lock wrote %s (stat error %v)", opts.outputFile, err)
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "holds the lock") {
+		t.Errorf("last log entry %v, want a warning that the lock is held", e)
+	}
+
+	release()
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(opts.outputFile); err != nil {
+		t.Errorf("a run after the lock was released: %v", err)
+	}
+	again, ok, _, err := acquireLock(path)
+	if err != nil || !ok {
+		t.Fatalf("acquireLock after the run released it: ok %v, err %v", ok, err)
+	}
+	again()
+}
@@ -1,196 +1,684 @@
 package main
 
 import (
+	"cometbft-peer-filter/peerfilter"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"io"
-	"net/http"
 	"os"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	Timeout    = 30
-	targetHost = "localhost:26657" // formerly InitialHost
-	TopPeers   = 5                 // top N peers to display
-)
+// options holds the command-line settings. Everything that affects peer
+// selection and formatting lives in the embedded peerfilter.Options.
+type options struct {
+	peerfilter.Options
+	syslog         bool
+	syslogFacility string
+	syslogTag      string
+	watchFile      string
+	watchDebounce  time.Duration
+	interval       time.Duration
+	logLevel       string
+	noColor        bool
+	metricsFile    string
+	metaFile       string
+	outputFile     string
+	outputHistory  int
+	validateOnly   bool
+	validateDial   bool
+	sqlitePath     string
+	etcdEndpoint   string
+	etcdKey        string
+	slaWebhook     string
+	patchURL       string
+	patchPath      string
+	metricsTopOnly bool
+	settingsDir    string
+	auditFile      string
+	stateFile      string
+	sinceLastRun   bool
+	warmup         time.Duration
+	reportGini     bool
+	execCommand    string
+	listen         string
+	splitDir       bool
+	onceAndWatch   bool
+	clipboard      bool
+	timeseriesCSV  string
+	lockfile       string
 
-// Status represents transfer status (embedded in ConnectionStatus)
-type Status struct {
-	Start    time.Time // Transfer start time
-	Bytes    string
-	Samples  string
-	InstRate string
-	CurRate  string
-	AvgRate  string
-	PeakRate string
-	BytesRem string
-	Duration string
-	Idle     string
-	TimeRem  string
-	Progress Percent
-	Active   bool
+	// warmupUntil is when -warmup ends; runs before it write nothing.
+	warmupUntil time.Time
+	// deadline is when -deadline aborts the process, zero if unset.
+	deadline time.Time
+	// api serves the selections of a daemon started with -listen.
+	api *apiServer
+	// args are the command-line arguments, parsed again when the
+	// -settings-dir changes.
+	args []string
 }
 
-type Percent uint32
+// secretFlags are the flags whose values Options.Flags leaves out.
+var secretFlags = map[string]bool{"anonymize-salt": true, "sla-webhook": true}
 
-// CometBFTNetInfoResult and related types (for unmarshaling net_info)
-type CometBFTNetInfoResult struct {
-	Result  ResultNetInfo `json:"result"`
-	ID      any           `json:"id"`
-	Jsonrpc string        `json:"jsonrpc"`
-}
+// parseFlags parses the command-line arguments, filling in settings not
+// given there from -settings-dir.
+func parseFlags(args []string) (options, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	o := options{args: args}
+	var hosts string
+	fs.StringVar(&hosts, "host", peerfilter.DefaultHost, "comma-separated RPC hosts to query; peers seen by several hosts are merged")
+	fromFiles := fs.String("from-file", "", "comma-separated saved net_info responses or glob patterns to read instead of querying -host; several files are merged like several hosts")
+	fs.StringVar(&o.AddrBook, "addrbook", "", "read peers from this CometBFT addrbook.json instead of querying -host; they have addresses but no traffic stats")
+	fs.BoolVar(&o.AddrBookMerge, "addrbook-merge", false, "merge the -addrbook peers with those from -host or -from-file instead of replacing them")
+	fs.Float64Var(&o.MinHostSuccess, "min-host-success", 0, "fail unless at least this fraction of the hosts answer")
+	fs.IntVar(&o.TopPeers, "top", peerfilter.DefaultTopPeers, "number of peers to select")
+	fs.BoolVar(&o.All, "all", false, "select every peer that passes the filters, in rank order, ignoring -top")
+	fs.DurationVar(&o.Timeout, "timeout", peerfilter.DefaultTimeout, "timeout for each net_info request")
+	fs.DurationVar(&o.ConnectTimeout, "connect-timeout", 0, "timeout for connecting to an RPC host (0 leaves it to -timeout)")
+	fs.DurationVar(&o.TLSHandshakeTimeout, "tls-handshake-timeout", 10*time.Second, "timeout for the TLS handshake with an https RPC host")
+	fs.DurationVar(&o.ReadTimeout, "read-timeout", 0, "timeout for waiting for the net_info response headers and for reading its body (0 leaves it to -timeout)")
+	fs.StringVar(&o.settingsDir, "settings-dir", "", "read settings not given as flags from files named after them in this directory (e.g. a mounted ConfigMap)")
+	fs.BoolVar(&o.Shuffle, "shuffle", false, "randomize the order of the selected peers in the output (selection is still by rank)")
+	fs.Int64Var(&o.ShuffleSeed, "shuffle-seed", 0, "seed for -shuffle; 0 picks a time-based seed")
+	fs.BoolVar(&o.StableOutput, "stable-output", false, "order the selected peers by node ID in the output so committed files diff minimally (selection is still by rank)")
+	fs.BoolVar(&o.syslog, "syslog", false, "send log output to syslog instead of stderr")
+	fs.StringVar(&o.syslogFacility, "syslog-facility", "daemon", "syslog facility used with -syslog")
+	fs.StringVar(&o.syslogTag, "syslog-tag", "cometbft-peer-filter", "syslog tag used with -syslog")
+	fs.Float64Var(&o.MinPassRatio, "min-pass-ratio", 0.1, "warn when fewer than this fraction of peers pass the filters (0 disables)")
+	fs.StringVar(&o.OutputFormat, "output-format", "peerstring", "output format: peerstring, json, commented, consul, csv, systemd-env, tfvars, ids, md or full-json")
+	fs.StringVar(&o.watchFile, "watch-file", "", "keep running and re-fetch each time this trigger file is modified")
+	fs.DurationVar(&o.watchDebounce, "watch-debounce", time.Second, "coalesce -watch-file events arriving within this window")
+	fs.DurationVar(&o.interval, "interval", 0, "keep running and re-fetch at this interval (0 runs once)")
+	fs.StringVar(&o.listen, "listen", "", "with -interval, serve the current selection at GET /peers, an immediate re-fetch at POST /refresh and the metrics at GET /metrics on this address, e.g. :8080")
+	fs.BoolVar(&o.onceAndWatch, "once-and-watch", false, "with -interval or -watch-file, write the first run's output at once, even during -warmup, and exit if it fails")
+	fs.DurationVar(&o.warmup, "warmup", 0, "with -interval or -watch-file, keep collecting stats but write no output until this long after startup")
+	hysteresis := new(peerfilter.Hysteresis)
+	fs.IntVar(&hysteresis.Margin, "hysteresis-margin", 0, "with -interval or -watch-file, keep a selected peer until it ranks this many places below the top")
+	fs.IntVar(&hysteresis.Intervals, "hysteresis-intervals", 0, "with -interval or -watch-file, keep a selected peer until it has ranked outside the margin for this many runs in a row")
+	sla := new(peerfilter.SLA)
+	fs.Int64Var(&sla.MinRate, "sla-min-rate", 0, "alert when a selected peer's current send+recv rate in bytes/s stays below this (0 disables)")
+	fs.DurationVar(&sla.MaxIdle, "sla-max-idle", 0, "alert when a selected peer stays idle for longer than this (0 disables)")
+	fs.IntVar(&sla.Intervals, "sla-intervals", 1, "number of consecutive runs a peer must violate the SLA before an alert fires")
+	fs.StringVar(&o.slaWebhook, "sla-webhook", "", "POST SLA alerts as JSON to this URL in addition to logging them")
+	fs.IntVar(&o.MaxMonikerLen, "max-moniker-len", 0, "truncate monikers longer than this many characters in the output (0 disables)")
+	fs.StringVar(&o.SortBy, "sort-by", string(peerfilter.RankBytes), "rank peers by one of: "+rankKeyList())
+	fs.StringVar(&o.TieBreak, "sort-stable-secondary", "node_id", "break ties in -sort-by by one of: "+strings.Join(peerfilter.TieBreakKeys, ", "))
+	fs.Float64Var(&o.BlendRatio, "blend-ratio", 0.5, "weight of bytes versus rate for -sort-by=blend, between 0 and 1")
+	rateKernel := fs.String("rate-kernel", "uniform", "weights of the recent rates averaged by -sort-by=weighted-rate by age: uniform, linear, exponential, or comma-separated weights, latest run first")
+	stabilityWindow := fs.Int("stability-window", 10, "number of recent runs whose rates -sort-by=stability and weighted-rate use and -sparklines draws, with -interval or -watch-file")
+	fs.BoolVar(&o.Sparklines, "sparklines", false, "add a sparkline of each peer's rates over recent runs to -output-format=md")
+	fs.StringVar(&o.logLevel, "log-level", envOr("LOG_LEVEL", "info"), "log level: debug, info, warn or error; defaults to $LOG_LEVEL")
+	fs.BoolVar(&o.noColor, "no-color", os.Getenv("NO_COLOR") != "", "disable colored log output (colors are already off when stderr is not a terminal)")
+	fs.BoolVar(&o.DropZeroBytes, "drop-zero-bytes", false, "exclude peers that have transferred no bytes")
+	fs.IntVar(&o.DefaultP2PPort, "default-p2p-port", peerfilter.DefaultP2PPort, "port appended to listen addresses that do not include one")
+	fs.StringVar(&o.metricsFile, "metrics-file", "", "write metrics in Prometheus text format to this file after each run; every metric name starts with peer_filter_, e.g. peer_filter_peer_version_count")
+	fs.BoolVar(&o.ProbeRPC, "probe-rpc", false, "drop selected peers whose advertised RPC /health endpoint does not answer 200 OK")
+	fs.IntVar(&o.ProbeConcurrency, "probe-concurrency", peerfilter.DefaultProbeConcurrency, "maximum concurrent -probe-rpc and -sort-by=latency requests")
+	fs.DurationVar(&o.ProbeTimeout, "probe-timeout", 5*time.Second, "timeout for each -probe-rpc and -sort-by=latency request")
+	fs.BoolVar(&o.NoResolve, "no-resolve", false, "write each peer's listen_addr exactly as advertised, keeping 0.0.0.0 and any tcp:// prefix, for debugging")
+	fs.BoolVar(&o.CompactPeerString, "compact-peerstring", false, "in the peerstring, systemd-env and tfvars formats, leave out invalid entries and duplicate node IDs or addresses")
+	fs.IntVar(&o.MaxEntries, "max-entries", 0, "with -compact-peerstring, keep at most this many entries (0 keeps all)")
+	fs.IntVar(&o.MaxOutputBytes, "max-output-bytes", 0, "drop the lowest-ranked peers until the formatted output, after -output-encoding, fits in this many bytes (0 disables)")
+	deadline := fs.String("deadline", "", "RFC 3339 time, e.g. 2025-01-02T15:04:05Z, at which to abort the process and any run in progress")
+	fs.StringVar(&o.lockfile, "lockfile", "", "hold an exclusive lock on this file during each run and skip the run if another instance holds it")
+	fs.StringVar(&o.outputFile, "output-file", "peers.txt", "file the formatted peers are written to; empty skips it")
+	fs.BoolVar(&o.clipboard, "clipboard", false, "also copy the output to the system clipboard; with -output-file \"\" only copy it")
+	fs.BoolVar(&o.splitDir, "split-direction", false, "also write the inbound and outbound peers to their own files next to -output-file, e.g. peers-in.txt and peers-out.txt")
+	fs.BoolVar(&o.validateOnly, "validate-only", false, "check the entries of the existing -output-file instead of fetching net_info, and fail if any is invalid")
+	failMemory := &peerfilter.FailMemory{}
+	fs.StringVar(&failMemory.Path, "fail-memory", "", "file recording the peers that fail -validate-dial; selections skip them for -fail-cooldown")
+	fs.DurationVar(&failMemory.Cooldown, "fail-cooldown", time.Hour, "how long a peer recorded in -fail-memory stays excluded")
+	fs.BoolVar(&o.validateDial, "validate-dial", false, "with -validate-only, also require each entry to accept a TCP connection")
+	fs.StringVar(&o.OutputEncoding, "output-encoding", "raw", "encoding applied to the formatted output before it is written: raw or base64")
+	fs.IntVar(&o.outputHistory, "output-history", 0, "keep this many previous versions of -output-file as e.g. peers.1.txt, newest first")
+	fs.StringVar(&o.etcdEndpoint, "etcd-endpoint", "", "comma-separated etcd endpoints to also write the formatted peers to")
+	fs.StringVar(&o.etcdKey, "etcd-key", "", "etcd key written with -etcd-endpoint")
+	fs.StringVar(&o.timeseriesCSV, "timeseries-csv", "", "append a row per selected peer, with the run's timestamp and the peer's rank before the -csv-columns, to this CSV file")
+	fs.StringVar(&o.sqlitePath, "sqlite", "", "append each run's stats and selected peers to this SQLite database")
+	fs.StringVar(&o.patchURL, "patch-url", "", "send the selected peers to this config service as a JSON merge patch (PATCH) whenever they change")
+	fs.StringVar(&o.patchPath, "patch-path", "p2p.persistent_peers", "dotted path of the field set by -patch-url")
+	fs.BoolVar(&o.reportGini, "report-gini", false, "log the Gini coefficient of the bytes across all peers, to spot traffic concentrated on a few peers")
+	fs.StringVar(&o.execCommand, "exec", "", "run this shell command after each write, with the formatted output on its stdin")
+	fs.StringVar(&o.auditFile, "audit-file", "", "write the selection rationale (filters and their drop counts, sort key, ranked peers with scores) as JSON to this file")
+	fs.StringVar(&o.metaFile, "meta-file", "", "write the run's timestamp, hosts and aggregates as JSON to this file")
+	fs.BoolVar(&o.TimestampHeader, "timestamp-header", false, "start the output with a \"# generated at\" comment; formats without comments need -meta-file instead")
+	fs.Int64Var(&o.MinRecentSent, "min-recent-sent", 0, "exclude peers whose RecentlySent bytes summed over all channels is below this")
+	channelWeights := fs.String("channel-weights", "", "comma-separated channel=weight pairs, e.g. 0x20=2.0,0x40=1.5, scaling each channel's RecentlySent for -sort-by=recent-sent and seed")
+	fs.DurationVar(&o.MaxPeerAge, "max-peer-age", 0, "exclude peers connected for longer than this, to rotate in fresh peers (0 disables)")
+	excludeVersions := fs.String("exclude-version", "", "comma-separated versions or glob patterns (e.g. 0.38.*) of peers to drop")
+	fs.StringVar(&o.VersionRegex, "version-regex", "", "keep only peers whose version matches this regular expression, e.g. '^v?0\\.3[78]\\.' for CometBFT releases")
+	denylist := new(peerfilter.Denylist)
+	fs.StringVar(&denylist.URL, "denylist-url", "", "exclude node IDs listed at this URL (JSON array or one per line)")
+	fs.DurationVar(&denylist.TTL, "denylist-ttl", 10*time.Minute, "how long a fetched -denylist-url is reused before fetching it again")
+	compatMatrix := fs.String("compat-matrix", "", "comma-separated block=app pairs, or @file with one per line, keeping only peers on a listed block protocol version with at least the given app version")
+	sybilPatterns := fs.String("sybil-patterns", "", "comma-separated regular expressions, or @file with one per line, for monikers of peers to drop as likely Sybils")
+	fs.BoolVar(&o.RequireTxIndex, "require-txindex", false, "keep only peers that report tx_index \"on\"")
+	fs.StringVar(&o.Network, "network", "", "keep only peers on this chain ID; empty detects it from the /status of -host (see -detect-network)")
+	fs.BoolVar(&o.DetectNetwork, "detect-network", true, "without -network, keep only peers on the chain ID that -host reports in /status")
+	fs.BoolVar(&o.RequireVersion, "require-version", false, "drop peers with an empty or malformed version string, often scanners")
+	fs.BoolVar(&o.SkipPortMismatch, "skip-port-mismatch", false, "drop outbound peers reached on a port other than the one they advertise, likely behind a port-mapping NAT")
+	fs.StringVar(&o.ConsulService, "consul-service", peerfilter.DefaultConsulService, "service name used by -output-format=consul")
+	fs.BoolVar(&o.Strict, "strict", false, "abort if any peer has a byte, rate or duration field that fails to parse, instead of treating it as zero")
+	fs.BoolVar(&o.Lean, "lean", false, "decode only node IDs, addresses and bytes from net_info to save CPU and memory on large peer sets")
+	fs.StringVar(&o.CSVColumns, "csv-columns", peerfilter.DefaultCSVColumns, "comma-separated columns for -output-format=csv")
+	fs.BoolVar(&o.metricsTopOnly, "metrics-top-only", false, "export per-peer metrics only for the selected peers to limit cardinality")
+	fs.StringVar(&o.ASNDatabase, "asn-db", "", "MaxMind GeoLite2-ASN database used to tag selected peers with their ASN and organization in json, csv and md output")
+	fs.BoolVar(&o.IncludeConnectionStatus, "include-connection-status", false, "embed each peer's send/recv monitors and channels in JSON output")
+	fs.StringVar(&o.SchemePrefix, "scheme-prefix", "", "prefix such as tcp:// prepended to each id@host:port entry in the peerstring, commented, systemd-env and tfvars formats")
+	fs.StringVar(&o.EnvKey, "env-key", peerfilter.DefaultEnvKey, "variable name written by -output-format=systemd-env")
+	fs.StringVar(&o.TFVarsKey, "tfvars-key", peerfilter.DefaultTFVarsKey, "variable name written by -output-format=tfvars")
+	fs.StringVar(&o.stateFile, "state-file", "", "with -since-last-run, file in which each run's selected node IDs are kept for the next run")
+	fs.BoolVar(&o.sinceLastRun, "since-last-run", false, "output only the peers that the previous run, recorded in -state-file, did not select")
+	fs.BoolVar(&o.BalanceDirection, "balance-direction", false, "select half of the top peers from inbound and half from outbound connections")
+	fs.IntVar(&o.MaxSamePort, "max-same-port", 0, "select at most this many peers listening on the same p2p port, warning when more do (0 disables)")
+	fs.Int64Var(&o.BandwidthBudget, "bandwidth-budget", 0, "select the peers covering the most total bytes whose current send+recv rates sum to at most this many bytes/s (0 disables)")
+	fs.BoolVar(&o.MaximizeChannels, "maximize-channel-coverage", false, "greedily select the peers that together advertise the most distinct channels, breaking ties by rank")
+	fs.IntVar(&o.FleetSize, "fleet-size", 0, "number of nodes sharing the ranked peers; each takes a different stripe of them (0 disables)")
+	fs.IntVar(&o.FleetIndex, "fleet-index", 0, "this node's index in the fleet, from 0 to -fleet-size minus 1")
+	fs.StringVar(&o.RPCMode, "rpc-mode", "uri", "how to call net_info: uri (GET /net_info) or jsonrpc (POST a JSON-RPC request)")
+	fs.StringVar(&o.RPCID, "rpc-id", "1", "JSON-RPC request id for -rpc-mode=jsonrpc; the response id must match")
+	fs.StringVar(&o.RPCMethod, "rpc-method", "", "HTTP method for net_info requests, GET or POST; empty picks it from -rpc-mode")
+	fs.StringVar(&o.RPCBody, "rpc-body", "", "raw request body sent with -rpc-method=POST, replacing the default; in jsonrpc mode the response id is not checked")
+	fs.BoolVar(&o.Anonymize, "anonymize", false, "replace remote IPs with hashed placeholders and redact monikers in the output, e.g. for sharing diagnostics")
+	fs.BoolVar(&o.AnonymizeIDs, "anonymize-ids", false, "with -anonymize, also hash node IDs")
+	redactFields := fs.String("redact", "", "comma-separated fields to blank in every output format, e.g. moniker,remote_ip")
+	fs.StringVar(&o.AnonymizeSalt, "anonymize-salt", "", "key for -anonymize hashes; empty uses a random key per process")
+	args, err := expandArgsFiles(fs, args)
+	if err != nil {
+		return o, err
+	}
+	fs.Parse(args)
 
-type ResultNetInfo struct {
-	Listening bool     `json:"listening"`
-	Listeners []string `json:"listeners"`
-	NPeers    string   `json:"n_peers"`
-	Peers     []Peer   `json:"peers"`
+	if o.settingsDir != "" {
+		if err := applySettingsDir(fs, o.settingsDir); err != nil {
+			return o, err
+		}
+	}
+
+	o.Flags = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "redacted"
+		}
+		o.Flags[f.Name] = value
+	})
+
+	if hysteresis.Margin > 0 || hysteresis.Intervals > 0 {
+		o.Hysteresis = hysteresis
+	}
+	if denylist.URL != "" {
+		o.Denylist = denylist
+	}
+	if o.SortBy == string(peerfilter.RankDelta) {
+		o.Deltas = new(peerfilter.Deltas)
+	}
+	if o.SortBy == string(peerfilter.RankStability) || o.SortBy == string(peerfilter.RankWeightedRate) || o.Sparklines {
+		kernel, err := peerfilter.ParseRateKernel(*rateKernel)
+		if err != nil {
+			return o, fmt.Errorf("invalid -rate-kernel: %w", err)
+		}
+		o.Stability = &peerfilter.Stability{Window: *stabilityWindow, Kernel: kernel}
+	}
+	if sla.MinRate > 0 || sla.MaxIdle > 0 {
+		o.SLA = sla
+	}
+	if failMemory.Path != "" {
+		o.FailMemory = failMemory
+	}
+	if o.sinceLastRun {
+		o.SinceLastRun = &peerfilter.SinceLastRun{Path: o.stateFile}
+	}
+
+	if *deadline != "" {
+		t, err := time.Parse(time.RFC3339, *deadline)
+		if err != nil {
+			return o, fmt.Errorf("invalid -deadline: %w", err)
+		}
+		o.deadline = t
+	}
+	o.Hosts = splitList(hosts)
+	o.ExcludeVersions = splitList(*excludeVersions)
+	o.FromFiles = splitList(*fromFiles)
+	o.Redact = splitList(*redactFields)
+	weights, err := peerfilter.ParseChannelWeights(*channelWeights)
+	if err != nil {
+		return o, fmt.Errorf("invalid -channel-weights: %w", err)
+	}
+	o.ChannelWeights = weights
+	if o.SybilPatterns, err = readPatterns(*sybilPatterns); err != nil {
+		return o, err
+	}
+	compat, err := readPatterns(*compatMatrix)
+	if err != nil {
+		return o, err
+	}
+	if o.CompatMatrix, err = peerfilter.ParseCompatMatrix(strings.Join(compat, ",")); err != nil {
+		return o, fmt.Errorf("invalid -compat-matrix: %w", err)
+	}
+	return o, nil
 }
 
-type Peer struct {
-	NodeInfo         DefaultNodeInfo  `json:"node_info"`
-	IsOutbound       bool             `json:"is_outbound"`
-	ConnectionStatus ConnectionStatus `json:"connection_status"`
-	RemoteIP         string           `json:"remote_ip"`
+// envOr returns the value of the environment variable key, or def if it
+// is unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
-type ConnectionStatus struct {
-	Duration    string
-	SendMonitor Status
-	RecvMonitor Status
-	Channels    []ChannelStatus
+// rankKeyList joins the rank keys for the -sort-by help text.
+func rankKeyList() string {
+	keys := make([]string, 0, len(peerfilter.RankKeys))
+	for _, k := range peerfilter.RankKeys {
+		keys = append(keys, string(k))
+	}
+	return strings.Join(keys, ", ")
 }
 
-type ChannelStatus struct {
-	ID                byte
-	SendQueueCapacity string
-	SendQueueSize     string
-	Priority          string
-	RecentlySent      string
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
-type DefaultNodeInfo struct {
-	ProtocolVersion ProtocolVersion      `json:"protocol_version"`
-	DefaultNodeID   string               `json:"id"`
-	ListenAddr      string               `json:"listen_addr"`
-	Network         string               `json:"network"`
-	Version         string               `json:"version"`
-	Channels        HexBytes             `json:"channels"`
-	Moniker         string               `json:"moniker"`
-	Other           DefaultNodeInfoOther `json:"other"`
+// readPatterns returns the patterns of a flag value that is either a
+// comma-separated list or, with a leading @, a file with one pattern per
+// line. Blank lines and lines starting with # are skipped in the file.
+func readPatterns(s string) ([]string, error) {
+	path, ok := strings.CutPrefix(s, "@")
+	if !ok {
+		return splitList(s), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading patterns from %s: %w", path, err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
 }
 
-type ProtocolVersion struct {
-	P2P   string `json:"p2p"`
-	Block string `json:"block"`
-	App   string `json:"app"`
+// loadOptions parses and validates the settings given by the
+// command-line arguments args.
+func loadOptions(args []string) (options, error) {
+	o, err := parseFlags(args)
+	if err != nil {
+		return o, err
+	}
+	if err := o.Validate(); err != nil {
+		return o, err
+	}
+	if o.validateOnly && o.outputFile == "" {
+		return o, errors.New("-validate-only needs an -output-file to check")
+	}
+	if o.interval > 0 && o.watchFile != "" {
+		return o, errors.New("-interval and -watch-file cannot be combined")
+	}
+	if o.onceAndWatch && o.interval == 0 && o.watchFile == "" {
+		return o, errors.New("-once-and-watch needs -interval or -watch-file")
+	}
+	if o.warmup > 0 && o.interval == 0 && o.watchFile == "" {
+		return o, errors.New("-warmup needs -interval or -watch-file")
+	}
+	if o.splitDir && o.outputFile == "" {
+		return o, errors.New("-split-direction needs an -output-file")
+	}
+	if o.splitDir && o.Lean {
+		return o, errors.New("-lean does not decode peer directions and cannot be used with -split-direction")
+	}
+	if o.listen != "" && o.interval == 0 {
+		return o, errors.New("-listen needs -interval")
+	}
+	if !o.deadline.IsZero() && !time.Now().Before(o.deadline) {
+		return o, fmt.Errorf("-deadline %s has already passed", o.deadline.Format(time.RFC3339))
+	}
+	if o.sinceLastRun && o.stateFile == "" {
+		return o, errors.New("-since-last-run needs a -state-file")
+	}
+	if o.stateFile != "" && !o.sinceLastRun {
+		return o, errors.New("-state-file is only used with -since-last-run")
+	}
+	if (o.etcdEndpoint == "") != (o.etcdKey == "") {
+		return o, errors.New("-etcd-endpoint and -etcd-key must be given together")
+	}
+	if o.timeseriesCSV != "" {
+		if _, err := peerfilter.FormatTimeSeries(&peerfilter.Result{}, o.Options, true); err != nil {
+			return o, fmt.Errorf("invalid -csv-columns for -timeseries-csv: %w", err)
+		}
+	}
+	if o.TimestampHeader && !peerfilter.SupportsComments(o.OutputFormat) && o.metaFile == "" {
+		return o, fmt.Errorf("-output-format=%s has no comments; use -meta-file to record the timestamp", o.OutputFormat)
+	}
+	return o, nil
 }
 
-type HexBytes string
+// logFormatter returns the log formatter for -no-color. The text formatter
+// only colors output when it is writing to a terminal.
+func logFormatter(noColor bool) log.Formatter {
+	return &log.TextFormatter{DisableColors: noColor}
+}
 
-type DefaultNodeInfoOther struct {
-	TxIndex    string `json:"tx_index"`
-	RPCAddress string `json:"rpc_address"`
+// setupLogging applies -log-level, -no-color and -syslog to the standard
+// logger.
+func setupLogging(opts options) error {
+	level, err := log.ParseLevel(opts.logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	log.SetFormatter(logFormatter(opts.noColor))
+	if opts.syslog {
+		if err := setupSyslog(opts.syslogFacility, opts.syslogTag); err != nil {
+			return fmt.Errorf("error setting up syslog: %w", err)
+		}
+	}
+	return nil
 }
 
 func main() {
-	log.SetLevel(log.InfoLevel)
+	opts, err := loadOptions(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := setupLogging(opts); err != nil {
+		log.Fatal(err)
+	}
+
+	if !opts.deadline.IsZero() {
+		time.AfterFunc(time.Until(opts.deadline), func() {
+			log.Fatalf("Deadline %s reached, aborting", opts.deadline.Format(time.RFC3339))
+		})
+	}
+
+	if opts.validateOnly {
+		timeout := opts.ConnectTimeout
+		if timeout == 0 {
+			timeout = opts.Timeout
+		}
+		if err := validateFile(opts.outputFile, opts.OutputEncoding, opts.validateDial, timeout, opts.FailMemory); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	client := &http.Client{
-		Timeout: Timeout * time.Second,
+	if opts.interval == 0 && opts.watchFile == "" {
+		if err := run(opts); err != nil {
+			log.Error(err)
+			os.Exit(exitStatus(err))
+		}
+		return
 	}
 
-	// Fetch the peer info from targetHost's /net_info endpoint.
-	resp, err := client.Get(addPrefix(fmt.Sprintf("%s/net_info", targetHost)))
+	if err := runWatching(opts, nil); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runWatching runs the selection every -interval, or on each change to
+// -watch-file, starting the -warmup now. With -once-and-watch the first
+// run is made at once and written even during the warmup; if it fails,
+// runWatching returns its error. The daemon runs until stop is closed, or
+// forever if stop is nil; the watcher runs until it fails.
+func runWatching(opts options, stop <-chan struct{}) error {
+	opts.warmupUntil = time.Now().Add(opts.warmup)
+	// Serve before the first run, so /peers has its selection as soon as
+	// -once-and-watch has written it.
+	if opts.listen != "" {
+		api, err := serveAPI(opts.listen)
+		if err != nil {
+			return err
+		}
+		opts.api = api
+	}
+	if opts.onceAndWatch {
+		first := opts
+		first.warmupUntil = time.Time{}
+		if err := run(first); err != nil {
+			return err
+		}
+	}
+	if opts.interval > 0 {
+		runDaemon(opts, stop)
+		return nil
+	}
+
+	runLogged := func() {
+		if err := run(opts); err != nil {
+			log.Error(err)
+		}
+	}
+	if !opts.onceAndWatch {
+		runLogged()
+	}
+	log.Infof("Watching %s for changes", opts.watchFile)
+	if err := watchFile(opts.watchFile, opts.watchDebounce, runLogged); err != nil {
+		return fmt.Errorf("error watching %s: %w", opts.watchFile, err)
+	}
+	return nil
+}
+
+// run selects the top peers once and writes the result file. During
+// -warmup the selection only feeds the stats and nothing is written. With
+// -lockfile, a run that finds the lock held is skipped.
+func run(opts options) error {
+	start := time.Now()
+	if opts.lockfile != "" {
+		release, ok, holder, err := acquireLock(opts.lockfile)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if holder == "" {
+				holder = "another process"
+			} else {
+				holder = "process " + holder
+			}
+			log.Warnf("Skipping this run: %s holds the lock on %s", holder, opts.lockfile)
+			return nil
+		}
+		defer release()
+	}
+	warmingUp := time.Now().Before(opts.warmupUntil)
+	if warmingUp {
+		// Nothing is output while warming up, so the last run is neither
+		// filtered against nor replaced.
+		opts.SinceLastRun = nil
+	}
+	ctx := context.Background()
+	if !opts.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, opts.deadline)
+		defer cancel()
+	}
+	res, err := peerfilter.SelectTopPeers(ctx, opts.Options)
 	if err != nil {
-		log.Fatalf("Error fetching net_info from target host %s: %v", targetHost, err)
+		return err
+	}
+
+	log.Infof("Top %d peers by %s:", len(res.Peers), res.Metadata.SortBy)
+	for _, p := range res.Peers {
+		log.Infof("Peer: %s, TotalBytes: %d, Moniker: %s, Network: %s, Protocol: p2p=%s block=%s app=%s",
+			p.RemoteIP,
+			p.TotalBytes,
+			p.Moniker,
+			p.Network,
+			p.ProtocolVersion.P2P,
+			p.ProtocolVersion.Block,
+			p.ProtocolVersion.App,
+		)
+	}
+
+	if opts.reportGini {
+		log.Infof("Gini coefficient of traffic across %d peers: %.3f", res.Aggregates.TotalPeers, res.Aggregates.Gini)
+	}
+
+	for _, a := range res.Alerts {
+		log.Warnf("SLA violated by peer %s (%s) for %d runs: %s", a.NodeID, a.Moniker, a.Intervals, a.Reason)
+	}
+	if len(res.Alerts) > 0 && opts.slaWebhook != "" {
+		if err := postAlerts(opts.slaWebhook, res.Alerts, opts.Timeout); err != nil {
+			log.Errorf("Error sending SLA alerts: %v", err)
+		}
+	}
+
+	if warmingUp {
+		peerfilter.RecordMetrics(res, opts.metricsTopOnly)
+		log.Infof("Warming up until %s, not writing output", opts.warmupUntil.Format(time.RFC3339))
+		return nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Format trims res to what fits -max-output-bytes, so everything
+	// below sees the peers that are actually written.
+	resultFile, err := peerfilter.Format(res, opts.Options)
 	if err != nil {
-		log.Fatalf("Error reading response body: %v", err)
+		return fmt.Errorf("error formatting output: %w", err)
 	}
+	peerfilter.RecordMetrics(res, opts.metricsTopOnly)
 
-	var netInfoRes CometBFTNetInfoResult
-	if err = json.Unmarshal(body, &netInfoRes); err != nil {
-		log.Fatalf("Error unmarshaling JSON: %v", err)
+	if opts.outputFile != "" {
+		if opts.outputHistory > 0 {
+			if err := rotateOutput(opts.outputFile, opts.outputHistory); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(opts.outputFile, []byte(resultFile), 0644); err != nil {
+			return wrapWriteError("result file", opts.outputFile, err)
+		}
+		if opts.splitDir {
+			if err := writeSplitDirection(res, opts); err != nil {
+				return err
+			}
+		}
 	}
 
-	peers := netInfoRes.Result.Peers
+	if opts.clipboard {
+		copyToClipboard(resultFile)
+	}
 
-	// Create a slice to hold peers with their total transferred bytes.
-	type peerWithBytes struct {
-		peer       Peer
-		totalBytes int64
+	if opts.etcdEndpoint != "" {
+		if err := writeEtcd(opts.etcdEndpoint, opts.etcdKey, resultFile, opts.Timeout); err != nil {
+			return err
+		}
 	}
-	var peersWithBytes []peerWithBytes
 
-	for _, p := range peers {
+	if opts.patchURL != "" {
+		peerOpts := opts.Options
+		peerOpts.OutputFormat = "peerstring"
+		peerOpts.OutputEncoding = ""
+		peerOpts.MaxOutputBytes = 0
+		peerOpts.TimestampHeader = false
+		peers, err := peerfilter.Format(res, peerOpts)
+		if err != nil {
+			return fmt.Errorf("error formatting peers for %s: %w", opts.patchURL, err)
+		}
+		if err := patchConfig(opts.patchURL, opts.patchPath, peers, opts.Timeout); err != nil {
+			return err
+		}
+	}
 
-		// Parse the "Bytes" fields from both SendMonitor and RecvMonitor.
-		sendBytes, _ := parseBytes(p.ConnectionStatus.SendMonitor.Bytes)
-		recvBytes, _ := parseBytes(p.ConnectionStatus.RecvMonitor.Bytes)
-		total := sendBytes + recvBytes
+	if opts.sqlitePath != "" {
+		if err := recordHistory(opts.sqlitePath, res); err != nil {
+			return err
+		}
+	}
 
-		peersWithBytes = append(peersWithBytes, peerWithBytes{
-			peer:       p,
-			totalBytes: total,
-		})
+	if opts.timeseriesCSV != "" {
+		if err := appendTimeSeries(opts.timeseriesCSV, res, opts.Options); err != nil {
+			return err
+		}
 	}
 
-	// Sort the peers by total bytes transferred in descending order.
-	sort.Slice(peersWithBytes, func(i, j int) bool {
-		return peersWithBytes[i].totalBytes > peersWithBytes[j].totalBytes
-	})
+	if opts.metaFile != "" {
+		if err := writeMetaFile(opts.metaFile, res); err != nil {
+			return err
+		}
+	}
 
-	// Select the top N peers.
-	topCount := TopPeers
-	if len(peersWithBytes) < TopPeers {
-		topCount = len(peersWithBytes)
-	}
-	topPeers := peersWithBytes[:topCount]
-
-	var resultFile string
-	log.Infof("Top %d peers by bytes transferred:", topCount)
-	for idx, p := range topPeers {
-		log.Infof("Peer: %s, TotalBytes: %d, Moniker: %s, Network: %s",
-			p.peer.RemoteIP,
-			p.totalBytes,
-			p.peer.NodeInfo.Moniker,
-			p.peer.NodeInfo.Network,
-		)
-		ListenAddr := strings.Replace(p.peer.NodeInfo.ListenAddr, "tcp://", "", -1)
-		if strings.Contains(ListenAddr, "0.0.0.0") {
-			ListenAddr = strings.Replace(ListenAddr, "0.0.0.0", p.peer.RemoteIP, -1)
+	if opts.auditFile != "" {
+		if err := writeAuditFile(opts.auditFile, res); err != nil {
+			return err
 		}
-		resultFile = fmt.Sprintf("%s%s@%s", resultFile, p.peer.NodeInfo.DefaultNodeID, ListenAddr)
-		if idx < len(topPeers)-1 {
-			resultFile = fmt.Sprintf("%s,", resultFile)
+	}
+
+	if opts.execCommand != "" {
+		if err := runExec(opts.execCommand, resultFile, opts.Timeout); err != nil {
+			return err
 		}
 	}
 
-	err = os.WriteFile("peers.txt", []byte(resultFile), 0644)
-	if err != nil {
-		log.Fatalf("Error writing result file: %v", err)
+	// Only now has every selected peer been handed out.
+	if opts.SinceLastRun != nil {
+		if err := opts.SinceLastRun.Save(res); err != nil {
+			return err
+		}
+	}
+
+	elapsed := time.Since(start)
+	log.Infof("Run took %s from fetch to write", elapsed.Round(time.Millisecond))
+	if opts.interval > 0 && elapsed > opts.interval {
+		log.Warnf("Run took %s, longer than the %s -interval", elapsed.Round(time.Millisecond), opts.interval)
+	}
+	peerfilter.RecordRunDuration(elapsed)
+
+	if opts.metricsFile != "" {
+		if err := peerfilter.WriteMetricsFile(opts.metricsFile); err != nil {
+			return wrapWriteError("metrics file", opts.metricsFile, err)
+		}
+	}
+
+	if opts.api != nil {
+		opts.api.update(res)
 	}
+	return nil
 }
 
-// parseBytes converts a string (assumed to represent a number) to int64.
-// On error, it returns 0.
-func parseBytes(s string) (int64, error) {
-	return strconv.ParseInt(s, 10, 64)
+// writeAuditFile records why res selected the peers it did.
+func writeAuditFile(path string, res *peerfilter.Result) error {
+	audit := struct {
+		GeneratedAt time.Time `json:"generated_at"`
+		peerfilter.Audit
+	}{res.Metadata.FetchedAt.UTC(), res.Audit()}
+	out, err := json.MarshalIndent(audit, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding audit file: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return wrapWriteError("audit file", path, err)
+	}
+	return nil
 }
 
-// addPrefix ensures the URL has an "http://" prefix.
-func addPrefix(host string) string {
-	if strings.HasPrefix(host, "http") {
-		return host
+// writeMetaFile records when and from where res was produced, next to the
+// result file.
+func writeMetaFile(path string, res *peerfilter.Result) error {
+	meta := struct {
+		GeneratedAt time.Time `json:"generated_at"`
+		peerfilter.Metadata
+		Aggregates peerfilter.Aggregates `json:"aggregates"`
+	}{res.Metadata.FetchedAt.UTC(), res.Metadata, res.Aggregates}
+	out, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding meta file: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return wrapWriteError("meta file", path, err)
 	}
-	return fmt.Sprintf("http://%s", host)
+	return nil
 }
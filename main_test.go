@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"cometbft-peer-filter/peerfilter"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPeers returns n peers at 10.0.0.1 to 10.0.0.n with node IDs made of
+// their index digit, ranked in that order by bytes. Odd peers are
+// outbound.
+func testPeers(n int) []peerfilter.Peer {
+	peers := make([]peerfilter.Peer, 0, n)
+	for i := 1; i <= n; i++ {
+		bytes := strconv.Itoa(1000 * (n - i + 1))
+		peers = append(peers, peerfilter.Peer{
+			NodeInfo: peerfilter.DefaultNodeInfo{
+				DefaultNodeID: strings.Repeat(strconv.Itoa(i%10), 40),
+				ListenAddr:    fmt.Sprintf("tcp://10.0.0.%d:26656", i),
+				Network:       "testnet-1",
+				Version:       "0.38.12",
+				Moniker:       fmt.Sprintf("peer-%d", i),
+			},
+			IsOutbound: i%2 == 1,
+			ConnectionStatus: peerfilter.ConnectionStatus{
+				Duration:    "3600000000000",
+				SendMonitor: peerfilter.Status{Bytes: bytes, CurRate: "100"},
+				RecvMonitor: peerfilter.Status{Bytes: bytes, CurRate: "100"},
+			},
+			RemoteIP: fmt.Sprintf("10.0.0.%d", i),
+		})
+	}
+	return peers
+}
+
+// testPeerEntry returns the persistent_peers entry of testPeers peer i.
+func testPeerEntry(i int) string {
+	return fmt.Sprintf("%s@10.0.0.%d:26656", strings.Repeat(strconv.Itoa(i%10), 40), i)
+}
+
+// serveNetInfo starts an RPC stub answering /net_info with peers and
+// returns its URL.
+func serveNetInfo(t *testing.T, peers []peerfilter.Peer) string {
+	t.Helper()
+	body, err := json.Marshal(peerfilter.CometBFTNetInfoResult{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Result:  peerfilter.ResultNetInfo{Listening: true, NPeers: strconv.Itoa(len(peers)), Peers: peers},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/net_info" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// serveGrowingNetInfo starts an RPC stub whose /net_info reports
+// testPeers(n) on its nth fetch. It returns its URL and the fetch count.
+func serveGrowingNetInfo(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	fetches := new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/net_info" {
+			http.NotFound(w, r)
+			return
+		}
+		peers := testPeers(int(fetches.Add(1)))
+		json.NewEncoder(w).Encode(peerfilter.CometBFTNetInfoResult{
+			Jsonrpc: "2.0",
+			ID:      1,
+			Result:  peerfilter.ResultNetInfo{NPeers: strconv.Itoa(len(peers)), Peers: peers},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, fetches
+}
+
+// testOptions parses and validates args like loadOptions, with the output
+// written to a temporary directory unless args set -output-file.
+func testOptions(t *testing.T, args ...string) options {
+	t.Helper()
+	args = append([]string{"-output-file", filepath.Join(t.TempDir(), "peers.txt")}, args...)
+	o, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	o, err := parseFlags([]string{"-no-color"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.noColor {
+		t.Error("-no-color did not disable colors")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if o, err = parseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !o.noColor {
+		t.Error("NO_COLOR did not disable colors")
+	}
+
+	// A buffer is not a terminal, so neither formatter may color.
+	for _, noColor := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger := log.New()
+		logger.SetOutput(&buf)
+		logger.SetFormatter(logFormatter(noColor))
+		logger.Warn("careful")
+		if strings.Contains(buf.String(), "\x1b[") {
+			t.Errorf("noColor=%v: log line %q has ANSI escape codes", noColor, buf.String())
+		}
+	}
+}
+
+func TestLogLevelEnv(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	t.Setenv("LOG_LEVEL", "debug")
+	for _, tt := range []struct {
+		args []string
+		want log.Level
+	}{
+		{nil, log.DebugLevel},
+		{[]string{"-log-level", "warn"}, log.WarnLevel},
+	} {
+		o, err := parseFlags(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := setupLogging(o); err != nil {
+			t.Fatal(err)
+		}
+		if got := log.GetLevel(); got != tt.want {
+			t.Errorf("LOG_LEVEL=debug with args %q: level %s, want %s", tt.args, got, tt.want)
+		}
+	}
+
+	t.Setenv("LOG_LEVEL", "chatty")
+	o, err := parseFlags(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setupLogging(o); err == nil {
+		t.Error("LOG_LEVEL=chatty was accepted")
+	}
+}
+
+func TestRunWarmup(t *testing.T) {
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)), "-interval", "1m", "-warmup", "1h")
+	opts.warmupUntil = time.Now().Add(opts.warmup)
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(opts.outputFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("a run during the warmup wrote %s (stat error %v)", opts.outputFile, err)
+	}
+
+	opts.warmupUntil = time.Now().Add(-time.Second)
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(opts.outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testPeerEntry(1) + "," + testPeerEntry(2); string(data) != want {
+		t.Errorf("first run after the warmup wrote %q, want %q", data, want)
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	metrics := filepath.Join(t.TempDir(), "peer_filter.prom")
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)), "-metrics-file", metrics)
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seconds float64
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "peer_filter_run_duration_seconds "); ok {
+			if seconds, err = strconv.ParseFloat(v, 64); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if seconds <= 0 || seconds > 10 {
+		t.Errorf("run duration metric = %g seconds, want a small positive value:\n%s", seconds, data)
+	}
+	var logged bool
+	for _, e := range hook.AllEntries() {
+		logged = logged || strings.HasPrefix(e.Message, "Run took ")
+	}
+	if !logged {
+		t.Error("the run duration was not logged")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// lastPatched is the value most recently sent by patchConfig, so unchanged
+// peer lists are not pushed again on every run.
+var lastPatched *string
+
+// mergePatch returns the JSON merge patch (RFC 7396) setting the field at
+// the dotted path to value, e.g. {"p2p":{"persistent_peers":"..."}}.
+func mergePatch(path, value string) ([]byte, error) {
+	keys := strings.Split(path, ".")
+	var patch any = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		patch = map[string]any{keys[i]: patch}
+	}
+	return json.Marshal(patch)
+}
+
+// patchConfig sends a merge patch setting path to value to url, unless the
+// same value was already sent.
+func patchConfig(url, path, value string, timeout time.Duration) error {
+	if lastPatched != nil && *lastPatched == value {
+		return nil
+	}
+	body, err := mergePatch(path, value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building patch request for %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error patching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("patch to %s returned %s", url, resp.Status)
+	}
+	lastPatched = &value
+	return nil
+}
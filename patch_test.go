@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPatchConfig(t *testing.T) {
+	t.Cleanup(func() { lastPatched = nil })
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPatch || r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			t.Errorf("got a %s request of type %q, want a merge patch", r.Method, r.Header.Get("Content-Type"))
+		}
+		requests = append(requests, string(body))
+	}))
+	defer srv.Close()
+
+	for _, value := range []string{"a@10.0.0.1:26656", "a@10.0.0.1:26656", "b@10.0.0.2:26656"} {
+		if err := patchConfig(srv.URL, "p2p.persistent_peers", value, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		`{"p2p":{"persistent_peers":"a@10.0.0.1:26656"}}`,
+		`{"p2p":{"persistent_peers":"b@10.0.0.2:26656"}}`,
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("config service received %q, want %q with the unchanged value sent once", requests, want)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("patch %d = %s, want %s", i+1, requests[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package peerfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// addrBook is the part of CometBFT's addrbook.json used to list peers.
+type addrBook struct {
+	Addrs []struct {
+		Addr struct {
+			ID   string `json:"id"`
+			IP   string `json:"ip"`
+			Port uint16 `json:"port"`
+		} `json:"addr"`
+	} `json:"addrs"`
+}
+
+// readAddrBook lists the peers known to the address book at path. They
+// carry only a node ID and an address: without a live connection there
+// are no byte counts, rates or node info, so they rank last by any key
+// unless merged with net_info data.
+func readAddrBook(path string, defaultPort int) ([]peerWithBytes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading address book: %w", err)
+	}
+	var book addrBook
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, fmt.Errorf("error parsing address book %s: %w", path, err)
+	}
+
+	peers := make([]peerWithBytes, 0, len(book.Addrs))
+	for _, entry := range book.Addrs {
+		a := entry.Addr
+		if a.ID == "" || a.IP == "" {
+			continue
+		}
+		ip := normalizeIP(a.IP)
+		p := Peer{RemoteIP: ip}
+		p.NodeInfo.DefaultNodeID = a.ID
+		p.NodeInfo.ListenAddr = ip
+		if a.Port != 0 {
+			p.NodeInfo.ListenAddr = net.JoinHostPort(ip, strconv.Itoa(int(a.Port)))
+		}
+		peers = append(peers, peerWithBytes{
+			peer:    p,
+			address: peerAddress(p, defaultPort),
+			sources: []string{path},
+		})
+	}
+	return peers, nil
+}
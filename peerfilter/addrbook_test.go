@@ -0,0 +1,51 @@
+package peerfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadAddrBook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+	book := `{
+  "key": "0123456789abcdef",
+  "addrs": [
+    {"addr": {"id": "` + testID("a") + `", "ip": "192.0.2.1", "port": 26656}, "src": {"id": "", "ip": "0.0.0.0", "port": 0}, "buckets": [1], "bucket_type": 1},
+    {"addr": {"id": "` + testID("b") + `", "ip": "::ffff:192.0.2.2", "port": 0}, "buckets": [2], "bucket_type": 2},
+    {"addr": {"id": "", "ip": "192.0.2.3", "port": 26656}},
+    {"addr": {"id": "` + testID("c") + `", "ip": "2001:db8::1", "port": 26666}}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(book), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	peers, err := readAddrBook(path, 26657)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ id, ip, address string }{
+		{testID("a"), "192.0.2.1", "192.0.2.1:26656"},
+		{testID("b"), "192.0.2.2", "192.0.2.2:26657"},
+		{testID("c"), "2001:db8::1", "[2001:db8::1]:26666"},
+	}
+	if len(peers) != len(want) {
+		t.Fatalf("read %d peers, want %d", len(peers), len(want))
+	}
+	for i, w := range want {
+		p := peers[i]
+		if p.peer.NodeInfo.DefaultNodeID != w.id || p.peer.RemoteIP != w.ip || p.address != w.address {
+			t.Errorf("peer %d = %s %s %s, want %s %s %s", i, p.peer.NodeInfo.DefaultNodeID, p.peer.RemoteIP, p.address, w.id, w.ip, w.address)
+		}
+		if len(p.sources) != 1 || p.sources[0] != path {
+			t.Errorf("peer %d sources = %v, want [%s]", i, p.sources, path)
+		}
+		if p.totalBytes != 0 {
+			t.Errorf("peer %d has %d bytes, want none", i, p.totalBytes)
+		}
+	}
+
+	if _, err := readAddrBook(filepath.Join(t.TempDir(), "missing.json"), 26656); err == nil {
+		t.Error("reading a missing address book succeeded")
+	}
+}
@@ -0,0 +1,68 @@
+package peerfilter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync"
+)
+
+var (
+	processSaltOnce sync.Once
+	processSalt     []byte
+)
+
+// anonymizer replaces identifying peer fields with keyed hashes, so the
+// same input always maps to the same placeholder for a given salt.
+type anonymizer struct {
+	salt    []byte
+	hashIDs bool
+}
+
+// newAnonymizer returns an anonymizer keyed by salt. An empty salt uses a
+// random key generated once per process, which keeps placeholders stable
+// across runs of a long-lived process but not between processes.
+func newAnonymizer(salt string, hashIDs bool) anonymizer {
+	if salt != "" {
+		return anonymizer{salt: []byte(salt), hashIDs: hashIDs}
+	}
+	processSaltOnce.Do(func() {
+		processSalt = make([]byte, 32)
+		_, _ = rand.Read(processSalt)
+	})
+	return anonymizer{salt: processSalt, hashIDs: hashIDs}
+}
+
+func (a anonymizer) hash(prefix, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(value))
+	return prefix + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// apply returns copies of peers with remote IPs and address hosts hashed,
+// monikers redacted and, if enabled, node IDs hashed. Byte counts and order
+// are preserved.
+func (a anonymizer) apply(peers []peerWithBytes) []peerWithBytes {
+	out := make([]peerWithBytes, len(peers))
+	for i, p := range peers {
+		p.peer.RemoteIP = a.hash("ip-", p.peer.RemoteIP)
+		p.peer.NodeInfo.Moniker = "redacted"
+		if host, port, err := net.SplitHostPort(p.address); err == nil {
+			p.address = net.JoinHostPort(a.hash("ip-", host), port)
+		} else {
+			p.address = a.hash("ip-", p.address)
+		}
+		p.peer.NodeInfo.ListenAddr = p.address
+		p.peer.NodeInfo.Other.RPCAddress = ""
+		if a.hashIDs {
+			p.peer.NodeInfo.DefaultNodeID = a.hash("node-", p.peer.NodeInfo.DefaultNodeID)
+		}
+		out[i] = p
+	}
+	return out
+}
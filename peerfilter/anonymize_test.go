@@ -0,0 +1,34 @@
+package peerfilter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAnonymizeMetrics(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "alpha", 10, 10), testPeer(2, "beta", 5, 5))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 1, Anonymize: true, AnonymizeIDs: true, AnonymizeSalt: "salt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topOnly := range []bool{false, true} {
+		RecordMetrics(res, topOnly)
+		series := gaugeLabels(t, "peer_filter_peer_bytes")
+		if len(series) == 0 {
+			t.Fatal("no peer_filter_peer_bytes series")
+		}
+		for _, labels := range series {
+			if labels["moniker"] != "redacted" {
+				t.Errorf("topOnly=%v: moniker label %q, want redacted", topOnly, labels["moniker"])
+			}
+			if id := labels["node_id"]; id == testID("1") || id == testID("2") {
+				t.Errorf("topOnly=%v: node_id label %q is not hashed", topOnly, id)
+			}
+		}
+	}
+	selected := res.Peers[0].NodeID
+	RecordMetrics(res, true)
+	if got := gaugeLabels(t, "peer_filter_peer_bytes")[0]["node_id"]; got != selected {
+		t.Errorf("top-only node_id label %q, want the output's %q", got, selected)
+	}
+}
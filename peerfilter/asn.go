@@ -0,0 +1,50 @@
+package peerfilter
+
+import (
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+)
+
+// asnRecord is the part of a GeoLite2-ASN (or compatible) record used to
+// tag peers.
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// annotateASN sets the ASN and organization of each peer from the MaxMind
+// database at path. Peers whose IP is unknown to the database are left
+// untagged.
+func annotateASN(peers []peerWithBytes, path string) error {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening ASN database: %w", err)
+	}
+	defer db.Close()
+
+	for i := range peers {
+		ip := net.ParseIP(peers[i].peer.RemoteIP)
+		if ip == nil {
+			continue
+		}
+		var rec asnRecord
+		if err := db.Lookup(ip, &rec); err != nil {
+			log.Debugf("ASN lookup failed for %s: %v", peers[i].peer.RemoteIP, err)
+			continue
+		}
+		peers[i].asn = rec.Number
+		peers[i].asOrg = rec.Organization
+	}
+	return nil
+}
+
+// formatASN returns asn in decimal, or "" for an untagged peer.
+func formatASN(asn uint) string {
+	if asn == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(asn), 10)
+}
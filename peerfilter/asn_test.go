@@ -0,0 +1,131 @@
+package peerfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbEncoder writes values in the MaxMind DB data section format.
+type mmdbEncoder struct{ bytes.Buffer }
+
+// control writes the control byte(s) for a value of type typ and size
+// bytes or entries.
+func (e *mmdbEncoder) control(typ, size int) {
+	var sizeBits int
+	var extra []byte
+	switch {
+	case size < 29:
+		sizeBits = size
+	case size < 29+256:
+		sizeBits, extra = 29, []byte{byte(size - 29)}
+	default:
+		panic("mmdb value too large for the test encoder")
+	}
+	if typ <= 7 {
+		e.WriteByte(byte(typ<<5 | sizeBits))
+	} else {
+		e.WriteByte(byte(sizeBits))
+		e.WriteByte(byte(typ - 7))
+	}
+	e.Write(extra)
+}
+
+func (e *mmdbEncoder) string(s string) {
+	e.control(2, len(s))
+	e.WriteString(s)
+}
+
+// uint writes v as an unsigned integer of type typ: 5 for uint16, 6 for
+// uint32 or 9 for uint64.
+func (e *mmdbEncoder) uint(typ int, v uint64) {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	b = bytes.TrimLeft(b, "\x00")
+	e.control(typ, len(b))
+	e.Write(b)
+}
+
+// writeASNDatabase writes an IPv4 MaxMind DB mapping 10.0.0.0/8 to asn
+// and org, and returns its path.
+func writeASNDatabase(t *testing.T, asn uint, org string) string {
+	t.Helper()
+	// The search tree is a chain of 8 nodes following the bits of the
+	// first octet, 10; every other branch points to "no data".
+	const nodeCount = 8
+	var db bytes.Buffer
+	for i := range nodeCount {
+		bit := 10 >> (7 - i) & 1
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = nodeCount + 16 // the record at data offset 0
+		}
+		branches := [2]uint32{nodeCount, nodeCount}
+		branches[bit] = next
+		for _, b := range branches {
+			db.Write([]byte{byte(b >> 16), byte(b >> 8), byte(b)})
+		}
+	}
+	db.Write(make([]byte, 16))
+
+	var data mmdbEncoder
+	data.control(7, 2)
+	data.string("autonomous_system_number")
+	data.uint(6, uint64(asn))
+	data.string("autonomous_system_organization")
+	data.string(org)
+	db.Write(data.Bytes())
+
+	db.WriteString("\xab\xcd\xefMaxMind.com")
+	var meta mmdbEncoder
+	meta.control(7, 9)
+	meta.string("binary_format_major_version")
+	meta.uint(5, 2)
+	meta.string("binary_format_minor_version")
+	meta.uint(5, 0)
+	meta.string("build_epoch")
+	meta.uint(9, 1700000000)
+	meta.string("database_type")
+	meta.string("GeoLite2-ASN")
+	meta.string("description")
+	meta.control(7, 0)
+	meta.string("ip_version")
+	meta.uint(5, 4)
+	meta.string("languages")
+	meta.control(11, 0)
+	meta.string("node_count")
+	meta.uint(6, nodeCount)
+	meta.string("record_size")
+	meta.uint(5, 24)
+	db.Write(meta.Bytes())
+
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	if err := os.WriteFile(path, db.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestASNDatabase(t *testing.T) {
+	outside := testPeer(2, "outside", 5, 5)
+	outside.RemoteIP = "192.0.2.1"
+	host := serveNetInfo(t, testPeer(1, "inside", 10, 10), outside)
+	res, err := SelectTopPeers(context.Background(), Options{
+		Hosts:       []string{host},
+		ASNDatabase: writeASNDatabase(t, 64500, "Example Net"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Peers) != 2 {
+		t.Fatalf("selected %d peers, want 2", len(res.Peers))
+	}
+	if p := res.Peers[0]; p.ASN != 64500 || p.ASOrg != "Example Net" {
+		t.Errorf("peer in 10.0.0.0/8 tagged AS%d %q, want AS64500 Example Net", p.ASN, p.ASOrg)
+	}
+	if p := res.Peers[1]; p.ASN != 0 || p.ASOrg != "" {
+		t.Errorf("peer outside the database tagged AS%d %q, want no tag", p.ASN, p.ASOrg)
+	}
+}
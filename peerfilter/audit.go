@@ -0,0 +1,56 @@
+package peerfilter
+
+// Audit describes how the peers of a Result were selected: the input,
+// the filters and what each dropped, and every peer that passed them in
+// rank order with its score, with Options.Anonymize and Options.Redact
+// applied.
+type Audit struct {
+	InputPeers int          `json:"input_peers"`
+	Filters    []FilterDrop `json:"filters"`
+	SortBy     string       `json:"sort_by"`
+	Ranked     []AuditPeer  `json:"ranked"`
+}
+
+// FilterDrop is the number of peers one filter dropped.
+type FilterDrop struct {
+	Name    string `json:"name"`
+	Dropped int    `json:"dropped"`
+}
+
+// AuditPeer is one ranked peer of an Audit.
+type AuditPeer struct {
+	Rank       int     `json:"rank"`
+	NodeID     string  `json:"node_id"`
+	Moniker    string  `json:"moniker"`
+	Score      float64 `json:"score"`
+	TotalBytes int64   `json:"total_bytes"`
+	Selected   bool    `json:"selected"`
+}
+
+// Audit returns the selection rationale of r.
+func (r *Result) Audit() Audit {
+	a := Audit{
+		InputPeers: r.Aggregates.TotalPeers,
+		Filters:    make([]FilterDrop, 0, len(r.filters)),
+		SortBy:     r.Metadata.SortBy,
+		Ranked:     make([]AuditPeer, 0, len(r.passed)),
+	}
+	for _, name := range r.filters {
+		a.Filters = append(a.Filters, FilterDrop{Name: name, Dropped: r.Aggregates.FilterDrops[name]})
+	}
+	selected := make(map[int]bool, len(r.selected))
+	for _, p := range r.selected {
+		selected[p.rank] = true
+	}
+	for _, p := range r.scrub(r.passed) {
+		a.Ranked = append(a.Ranked, AuditPeer{
+			Rank:       p.rank,
+			NodeID:     p.peer.NodeInfo.DefaultNodeID,
+			Moniker:    p.peer.NodeInfo.Moniker,
+			Score:      p.score,
+			TotalBytes: p.totalBytes,
+			Selected:   selected[p.rank],
+		})
+	}
+	return a
+}
@@ -0,0 +1,36 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAuditJSON(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "a", 30, 30), testPeer(2, "b", 20, 20), testPeer(3, "silent", 0, 0))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 1, DropZeroBytes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(res.Audit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"input_peers": 3.0,
+		"filters":     []any{map[string]any{"name": "drop-zero-bytes", "dropped": 1.0}},
+		"sort_by":     "bytes",
+		"ranked": []any{
+			map[string]any{"rank": 1.0, "node_id": testID("1"), "moniker": "a", "score": 60.0, "total_bytes": 60.0, "selected": true},
+			map[string]any{"rank": 2.0, "node_id": testID("2"), "moniker": "b", "score": 40.0, "total_bytes": 40.0, "selected": false},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("audit = %s, want %v", data, want)
+	}
+}
@@ -0,0 +1,50 @@
+package peerfilter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseChannelWeights parses a comma-separated list of channel=weight
+// pairs such as "0x20=2.0,0x40=1.5". Channel IDs may be hex with a 0x
+// prefix or decimal; weights must be non-negative. Channels not listed
+// keep a weight of 1.
+func ParseChannelWeights(s string) (map[byte]float64, error) {
+	weights := make(map[byte]float64)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idStr, weightStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid channel weight %q, want channel=weight", pair)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel ID in %q: %w", pair, err)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight in %q: %w", pair, err)
+		}
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("invalid weight in %q: must be a finite, non-negative number", pair)
+		}
+		if _, dup := weights[byte(id)]; dup {
+			return nil, fmt.Errorf("channel %#x weighted more than once", id)
+		}
+		weights[byte(id)] = weight
+	}
+	return weights, nil
+}
+
+// channelWeight returns the weight of channel id, 1 if it has none.
+func channelWeight(weights map[byte]float64, id byte) float64 {
+	if w, ok := weights[id]; ok {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,51 @@
+package peerfilter
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseChannelWeights(t *testing.T) {
+	got, err := ParseChannelWeights(" 0x20=2.0, 64=1.5,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[byte]float64{0x20: 2, 0x40: 1.5}; !maps.Equal(got, want) {
+		t.Errorf("weights = %v, want %v", got, want)
+	}
+	for _, s := range []string{"0x20", "0x20=x", "0x100=1", "0x20=-1", "0x20=NaN", "0x20=1,32=2"} {
+		if _, err := ParseChannelWeights(s); err == nil {
+			t.Errorf("ParseChannelWeights(%q) succeeded", s)
+		}
+	}
+}
+
+func TestChannelWeightsRanking(t *testing.T) {
+	// mempool sends more in total, consensus less but on the boosted channel.
+	mempool := testPeer(1, "mempool", 10, 10)
+	mempool.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x30, RecentlySent: "500"}}
+	consensus := testPeer(2, "consensus", 10, 10)
+	consensus.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x20, RecentlySent: "300"}}
+
+	order := func(weights map[byte]float64) []string {
+		var peers []peerWithBytes
+		for _, p := range []Peer{mempool, consensus} {
+			pwb, err := newPeerWithBytes(p, DefaultP2PPort, weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peers = append(peers, pwb)
+		}
+		if err := sortPeers(peers, RankRecentSent, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+		return rankedMonikers(peers)
+	}
+	if got := order(nil); !slices.Equal(got, []string{"mempool", "consensus"}) {
+		t.Errorf("unweighted order %v, want mempool first", got)
+	}
+	if got := order(map[byte]float64{0x20: 2}); !slices.Equal(got, []string{"consensus", "mempool"}) {
+		t.Errorf("order with consensus weighted 2 = %v, want consensus first", got)
+	}
+}
@@ -0,0 +1,53 @@
+package peerfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseCompatMatrix parses comma-separated block=app pairs such as
+// "11=0,12=3": each supported block protocol version and the minimum app
+// version required with it.
+func ParseCompatMatrix(s string) (map[uint64]uint64, error) {
+	matrix := make(map[uint64]uint64)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		blockStr, appStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid compatibility entry %q, want block=app", pair)
+		}
+		block, err := strconv.ParseUint(strings.TrimSpace(blockStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block version in %q: %w", pair, err)
+		}
+		app, err := strconv.ParseUint(strings.TrimSpace(appStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid app version in %q: %w", pair, err)
+		}
+		if _, dup := matrix[block]; dup {
+			return nil, fmt.Errorf("block version %d listed more than once", block)
+		}
+		matrix[block] = app
+	}
+	return matrix, nil
+}
+
+// compatible reports whether v has a block version listed in matrix and
+// at least the app version required with it. Versions that are not
+// decimal numbers are never compatible.
+func compatible(matrix map[uint64]uint64, v ProtocolVersion) bool {
+	block, err := strconv.ParseUint(v.Block, 10, 64)
+	if err != nil {
+		return false
+	}
+	minApp, ok := matrix[block]
+	if !ok {
+		return false
+	}
+	app, err := strconv.ParseUint(v.App, 10, 64)
+	return err == nil && app >= minApp
+}
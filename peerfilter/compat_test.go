@@ -0,0 +1,32 @@
+package peerfilter
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompatMatrix(t *testing.T) {
+	matrix, err := ParseCompatMatrix("11=3, 12=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded := testPeer(1, "upgraded", 10, 10)
+	upgraded.NodeInfo.ProtocolVersion.App = "3"
+	// Block 11 is supported, but app 0 is below the 3 it requires.
+	stale := testPeer(2, "stale", 10, 10)
+	newer := testPeer(3, "newer", 10, 10)
+	newer.NodeInfo.ProtocolVersion.Block = "12"
+	unknown := testPeer(4, "unknown", 10, 10)
+	unknown.NodeInfo.ProtocolVersion = ProtocolVersion{P2P: "8", Block: "10", App: "9"}
+
+	got := keptMonikers(t, Options{CompatMatrix: matrix}, upgraded, stale, newer, unknown)
+	if want := []string{"upgraded", "newer"}; !slices.Equal(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"11", "x=1", "11=y", "11=1,11=2"} {
+		if _, err := ParseCompatMatrix(bad); err == nil {
+			t.Errorf("ParseCompatMatrix(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package peerfilter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns maps each column name accepted by -csv-columns to its value.
+var csvColumns = map[string]func(p peerWithBytes, opts Options) string{
+	"node_id":   func(p peerWithBytes, _ Options) string { return p.peer.NodeInfo.DefaultNodeID },
+	"address":   func(p peerWithBytes, _ Options) string { return p.address },
+	"remote_ip": func(p peerWithBytes, _ Options) string { return p.peer.RemoteIP },
+	"moniker": func(p peerWithBytes, o Options) string {
+		return truncateMoniker(p.peer.NodeInfo.Moniker, o.MaxMonikerLen)
+	},
+	"network":          func(p peerWithBytes, _ Options) string { return p.peer.NodeInfo.Network },
+	"version":          func(p peerWithBytes, _ Options) string { return p.peer.NodeInfo.Version },
+	"is_outbound":      func(p peerWithBytes, _ Options) string { return strconv.FormatBool(p.peer.IsOutbound) },
+	"total_bytes":      func(p peerWithBytes, _ Options) string { return strconv.FormatInt(p.totalBytes, 10) },
+	"cur_rate":         func(p peerWithBytes, _ Options) string { return strconv.FormatInt(p.curRate, 10) },
+	"recent_sent":      func(p peerWithBytes, _ Options) string { return strconv.FormatInt(p.recentSent, 10) },
+	"duration_seconds": func(p peerWithBytes, _ Options) string { return strconv.FormatFloat(p.duration.Seconds(), 'f', -1, 64) },
+	"asn":              func(p peerWithBytes, _ Options) string { return formatASN(p.asn) },
+	"as_org":           func(p peerWithBytes, _ Options) string { return p.asOrg },
+	"source_hosts":     func(p peerWithBytes, _ Options) string { return strings.Join(p.sources, ";") },
+}
+
+// parseCSVColumns splits a comma-separated column list and checks every
+// name against csvColumns.
+func parseCSVColumns(list string) ([]string, error) {
+	var columns []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if _, ok := csvColumns[c]; !ok {
+			known := make([]string, 0, len(csvColumns))
+			for name := range csvColumns {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown csv column %q (known: %s)", c, strings.Join(known, ", "))
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no csv columns given")
+	}
+	return columns, nil
+}
+
+// formatCSV renders a header row and one row per peer with the columns
+// selected by -csv-columns.
+func formatCSV(peers []peerWithBytes, opts Options) (string, error) {
+	columns, err := parseCSVColumns(opts.CSVColumns)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(columns); err != nil {
+		return "", err
+	}
+	row := make([]string, len(columns))
+	for _, p := range peers {
+		for i, c := range columns {
+			row[i] = csvColumns[c](p, opts)
+		}
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// FormatTimeSeries renders the selected peers of res as CSV rows for
+// appending to a time series: each row starts with the run's timestamp
+// and the peer's rank, followed by the -csv-columns. With header, a
+// header row comes first.
+func FormatTimeSeries(res *Result, opts Options, header bool) (string, error) {
+	opts = opts.withDefaults()
+	columns, err := parseCSVColumns(opts.CSVColumns)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if header {
+		if err := w.Write(append([]string{"timestamp", "rank"}, columns...)); err != nil {
+			return "", err
+		}
+	}
+	timestamp := res.Metadata.FetchedAt.UTC().Format(time.RFC3339)
+	row := make([]string, len(columns)+2)
+	for _, p := range res.selected {
+		row[0] = timestamp
+		row[1] = strconv.Itoa(p.rank)
+		for i, c := range columns {
+			row[i+2] = csvColumns[c](p, opts)
+		}
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
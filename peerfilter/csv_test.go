@@ -0,0 +1,21 @@
+package peerfilter
+
+import "testing"
+
+func TestFormatCSVColumns(t *testing.T) {
+	res := testResult(t, testPeer(1, "alpha, the first", 30, 30), testPeer(2, "beta", 10, 10))
+	out, err := Format(res, Options{OutputFormat: "csv", CSVColumns: "moniker, total_bytes,node_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "moniker,total_bytes,node_id\n" +
+		`"alpha, the first",60,` + testID("1") + "\n" +
+		"beta,20," + testID("2") + "\n"
+	if out != want {
+		t.Errorf("csv output =\n%s\nwant\n%s", out, want)
+	}
+
+	if _, err := Format(res, Options{OutputFormat: "csv", CSVColumns: "moniker,height"}); err == nil {
+		t.Error("an unknown csv column was accepted")
+	}
+}
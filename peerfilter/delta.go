@@ -0,0 +1,36 @@
+package peerfilter
+
+// Deltas remembers each peer's byte and sample counters between runs so
+// peers can be ranked by the traffic since the previous run (RankDelta).
+// The monitors' Samples count only grows while a connection is up, so a
+// drop in it, or in bytes, means the connection was reset; the delta is
+// then the bytes of the new connection. Peers seen for the first time have
+// a delta of 0.
+type Deltas struct {
+	prev map[string]counters
+}
+
+type counters struct {
+	bytes   int64
+	samples int64
+}
+
+// apply sets the delta of each peer and records its counters for the next
+// run. Peers that are gone are forgotten.
+func (d *Deltas) apply(peers []peerWithBytes) {
+	next := make(map[string]counters, len(peers))
+	for i := range peers {
+		p := &peers[i]
+		id := p.peer.NodeInfo.DefaultNodeID
+		cur := counters{bytes: p.totalBytes, samples: p.samples}
+		if prev, ok := d.prev[id]; ok {
+			if cur.samples < prev.samples || cur.bytes < prev.bytes {
+				p.delta = cur.bytes
+			} else {
+				p.delta = cur.bytes - prev.bytes
+			}
+		}
+		next[id] = cur
+	}
+	d.prev = next
+}
@@ -0,0 +1,46 @@
+package peerfilter
+
+import "testing"
+
+func TestDeltasReset(t *testing.T) {
+	d := new(Deltas)
+	peer := func(bytes int64, samples string) []peerWithBytes {
+		p := testPeer(1, "a", bytes, 0)
+		p.ConnectionStatus.SendMonitor.Samples = samples
+		p.ConnectionStatus.RecvMonitor.Samples = "0"
+		return parsedPeers(t, p)
+	}
+
+	first := peer(1000, "10")
+	d.apply(first)
+	if first[0].delta != 0 {
+		t.Errorf("first run delta = %d, want 0", first[0].delta)
+	}
+	grown := peer(1500, "20")
+	d.apply(grown)
+	if grown[0].delta != 500 {
+		t.Errorf("delta after growing = %d, want 500", grown[0].delta)
+	}
+	// More bytes but fewer samples: a new connection that has already
+	// moved more than the old one.
+	reset := peer(2000, "5")
+	d.apply(reset)
+	if reset[0].delta != 2000 {
+		t.Errorf("delta after a sample drop = %d, want the new connection's 2000", reset[0].delta)
+	}
+}
+
+func TestMergePeersSumsSamples(t *testing.T) {
+	a := parsedPeers(t, testPeer(1, "a", 100, 100))
+	b := parsedPeers(t, testPeer(1, "a", 50, 50))
+	merged := mergePeers([][]peerWithBytes{a, b})
+	if len(merged) != 1 {
+		t.Fatalf("merged into %d peers, want 1", len(merged))
+	}
+	if got, want := merged[0].samples, a[0].samples+b[0].samples; got != want {
+		t.Errorf("merged samples = %d, want %d", got, want)
+	}
+	if got := merged[0].totalBytes; got != 300 {
+		t.Errorf("merged bytes = %d, want 300", got)
+	}
+}
@@ -0,0 +1,95 @@
+package peerfilter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Denylist excludes peers whose node IDs are listed at URL, either as a
+// JSON array of strings or one ID per line ("#" starts a comment). The
+// list is fetched again once it is older than TTL. If a fetch fails, the
+// last list fetched is kept, or no peers are excluded if there is none.
+type Denylist struct {
+	URL string        `json:"url"`
+	TTL time.Duration `json:"ttl"`
+
+	ids       map[string]bool
+	fetchedAt time.Time
+}
+
+// refresh fetches the list if it has never been fetched or is stale.
+func (d *Denylist) refresh(ctx context.Context, timeout time.Duration) {
+	if d.ids != nil && time.Since(d.fetchedAt) < d.TTL {
+		return
+	}
+	ids, err := fetchDenylist(ctx, d.URL, timeout)
+	if err != nil {
+		if d.ids == nil {
+			log.Warnf("Proceeding without denylist: %v", err)
+		} else {
+			log.Warnf("Keeping denylist from %s: %v", d.fetchedAt.Format(time.RFC3339), err)
+		}
+		return
+	}
+	d.ids = ids
+	d.fetchedAt = time.Now()
+	log.Debugf("Fetched %d denylisted node IDs from %s", len(ids), d.URL)
+}
+
+// denied reports whether id is on the list.
+func (d *Denylist) denied(id string) bool {
+	return d.ids[id]
+}
+
+func fetchDenylist(ctx context.Context, url string, timeout time.Duration) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building denylist request: %w", err)
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching denylist from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("denylist %s returned %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading denylist: %w", err)
+	}
+	return parseDenylist(body)
+}
+
+// parseDenylist decodes a JSON array of node IDs or a newline-separated
+// list of them.
+func parseDenylist(body []byte) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	if trimmed := bytes.TrimSpace(body); bytes.HasPrefix(trimmed, []byte("[")) {
+		var list []string
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, fmt.Errorf("error decoding denylist: %w", err)
+		}
+		for _, id := range list {
+			ids[strings.TrimSpace(id)] = true
+		}
+		return ids, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			ids[line] = true
+		}
+	}
+	return ids, scanner.Err()
+}
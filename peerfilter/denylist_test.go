@@ -0,0 +1,78 @@
+package peerfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDenylist(t *testing.T) {
+	var fetches atomic.Int32
+	var body atomic.Value // the list served, or "" to fail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		b := body.Load().(string)
+		if b == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(b))
+	}))
+	t.Cleanup(srv.Close)
+	host := serveNetInfo(t, testPeer(1, "a", 10, 10), testPeer(2, "b", 20, 20), testPeer(3, "c", 30, 30))
+
+	for name, list := range map[string]string{
+		"json":     `["` + testID("2") + `", " ` + testID("3") + ` "]`,
+		"per line": "# known bad\n" + testID("2") + "\n\n" + testID("3") + " # spam\n",
+	} {
+		body.Store(list)
+		fetches.Store(0)
+		d := &Denylist{URL: srv.URL, TTL: time.Hour}
+		selected := func() string {
+			t.Helper()
+			res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, Denylist: d})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.Join(monikers(res.Peers), ",")
+		}
+
+		if got := selected(); got != "a" {
+			t.Errorf("%s list: selected %s, want only a", name, got)
+		}
+		// Within the TTL the list is not fetched again.
+		if got := selected(); got != "a" || fetches.Load() != 1 {
+			t.Errorf("%s list: second run selected %s after %d fetches, want a after 1", name, got, fetches.Load())
+		}
+		// A failed fetch of a stale list keeps the old one.
+		body.Store("")
+		d.fetchedAt = time.Now().Add(-2 * time.Hour)
+		if got := selected(); got != "a" || fetches.Load() != 2 {
+			t.Errorf("%s list: run after a failed fetch selected %s after %d fetches, want a after 2", name, got, fetches.Load())
+		}
+	}
+
+	// Without any list fetched, a failure excludes nothing.
+	d := &Denylist{URL: srv.URL, TTL: time.Hour}
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, Denylist: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "c,b,a" {
+		t.Errorf("with an unavailable denylist selected %s, want c,b,a", got)
+	}
+}
+
+func TestParseDenylist(t *testing.T) {
+	if _, err := parseDenylist([]byte(`["unterminated`)); err == nil {
+		t.Error("parseDenylist accepted a broken JSON array")
+	}
+	ids, err := parseDenylist([]byte(""))
+	if err != nil || len(ids) != 0 {
+		t.Errorf("parseDenylist of an empty body = %v, %v, want no IDs", ids, err)
+	}
+}
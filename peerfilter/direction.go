@@ -0,0 +1,17 @@
+package peerfilter
+
+// Direction returns a copy of r whose selection holds only the outbound
+// peers, or only the inbound ones, in the same order. Aggregates and
+// Metadata still describe the whole run.
+func (r *Result) Direction(outbound bool) *Result {
+	out := *r
+	out.Peers = nil
+	out.selected = nil
+	for i, p := range r.selected {
+		if p.peer.IsOutbound == outbound {
+			out.selected = append(out.selected, p)
+			out.Peers = append(out.Peers, r.Peers[i])
+		}
+	}
+	return &out
+}
@@ -0,0 +1,32 @@
+package peerfilter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// encodeOutput applies Options.OutputEncoding to the formatted output.
+func encodeOutput(out, encoding string) (string, error) {
+	switch encoding {
+	case "", "raw":
+		return out, nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString([]byte(out)), nil
+	default:
+		return "", fmt.Errorf("unknown output encoding %q, want raw or base64", encoding)
+	}
+}
+
+// DecodeOutput reverses the given Options.OutputEncoding, e.g. to
+// validate a written file.
+func DecodeOutput(data, encoding string) (string, error) {
+	if encoding != "base64" {
+		return data, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64 output: %w", err)
+	}
+	return string(decoded), nil
+}
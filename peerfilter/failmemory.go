@@ -0,0 +1,73 @@
+package peerfilter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FailMemory remembers the peers whose dial failed, e.g. in the CLI's
+// -validate-only -validate-dial mode, in a JSON file at Path, and keeps
+// them out of the selection until Cooldown has passed since the failure.
+// A later successful dial clears the record at once.
+type FailMemory struct {
+	Path     string        `json:"path"`
+	Cooldown time.Duration `json:"cooldown"`
+
+	failures map[string]time.Time // node ID to the time of its last failed dial
+}
+
+// Load reads the file at Path, replacing the records in memory. A missing
+// file holds no records.
+func (m *FailMemory) Load() error {
+	m.failures = make(map[string]time.Time)
+	data, err := os.ReadFile(m.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading fail memory: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.failures); err != nil {
+		return fmt.Errorf("error parsing fail memory %s: %w", m.Path, err)
+	}
+	return nil
+}
+
+// Record notes the outcome of dialing the peer with nodeID at time at.
+func (m *FailMemory) Record(nodeID string, failed bool, at time.Time) {
+	if m.failures == nil {
+		m.failures = make(map[string]time.Time)
+	}
+	if failed {
+		m.failures[nodeID] = at.UTC()
+	} else {
+		delete(m.failures, nodeID)
+	}
+}
+
+// Save writes the records still within Cooldown of now to Path.
+func (m *FailMemory) Save(now time.Time) error {
+	for id := range m.failures {
+		if !m.cooling(id, now) {
+			delete(m.failures, id)
+		}
+	}
+	data, err := json.MarshalIndent(m.failures, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.Path, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing fail memory: %w", err)
+	}
+	return nil
+}
+
+// cooling reports whether the peer with nodeID failed a dial less than
+// Cooldown before now.
+func (m *FailMemory) cooling(nodeID string, now time.Time) bool {
+	at, ok := m.failures[nodeID]
+	return ok && now.Sub(at) < m.Cooldown
+}
@@ -0,0 +1,70 @@
+package peerfilter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailMemoryCooldown(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "good", 10, 10), testPeer(2, "failed", 20, 20))
+	path := filepath.Join(t.TempDir(), "fail-memory.json")
+	selected := func(failedAt time.Time) string {
+		t.Helper()
+		m := &FailMemory{Path: path, Cooldown: time.Hour}
+		m.Record(testID("2"), true, failedAt)
+		// Saving as of the failure keeps the record in the file; the
+		// run then checks it against the current time.
+		if err := m.Save(failedAt); err != nil {
+			t.Fatal(err)
+		}
+		res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, FailMemory: &FailMemory{Path: path, Cooldown: time.Hour}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(monikers(res.Peers), ",")
+	}
+
+	now := time.Now()
+	if got := selected(now.Add(-30 * time.Minute)); got != "good" {
+		t.Errorf("within the cooldown selected %s, want only good", got)
+	}
+	if got := selected(now.Add(-2 * time.Hour)); got != "failed,good" {
+		t.Errorf("after the cooldown selected %s, want failed,good", got)
+	}
+}
+
+func TestFailMemorySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fail-memory.json")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := &FailMemory{Path: path, Cooldown: time.Hour}
+	m.Record(testID("1"), true, now.Add(-2*time.Hour))
+	m.Record(testID("2"), true, now.Add(-time.Minute))
+	m.Record(testID("3"), true, now.Add(-time.Minute))
+	// A later successful dial clears the failure.
+	m.Record(testID("3"), false, now)
+	if err := m.Save(now); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &FailMemory{Path: path, Cooldown: time.Hour}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{testID("1"): false, testID("2"): true, testID("3"): false} {
+		if got := loaded.cooling(id, now); got != want {
+			t.Errorf("peer %s cooling = %v after a reload, want %v", id[:1], got, want)
+		}
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), testID("1")) {
+		t.Errorf("expired record was saved: %s", data)
+	}
+
+	missing := &FailMemory{Path: filepath.Join(t.TempDir(), "missing.json")}
+	if err := missing.Load(); err != nil {
+		t.Errorf("loading a missing file: %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package peerfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jsonRPCRequest is a JSON-RPC 2.0 request body.
+type jsonRPCRequest struct {
+	JSONRPC string         `json:"jsonrpc"`
+	ID      any            `json:"id"`
+	Method  string         `json:"method"`
+	Params  map[string]any `json:"params"`
+}
+
+// fetchNetInfo requests net_info from host and returns the response body.
+// In "uri" mode it requests /net_info, by default with GET. In "jsonrpc"
+// mode it POSTs a JSON-RPC 2.0 request carrying opts.RPCID to the host
+// root. opts.RPCMethod and opts.RPCBody override the method and body.
+func fetchNetInfo(ctx context.Context, host string, opts Options) ([]byte, error) {
+	client := newRPCClient(opts)
+
+	var url string
+	var body []byte
+	switch opts.RPCMode {
+	case "uri":
+		url = addPrefix(fmt.Sprintf("%s/net_info", host))
+	case "jsonrpc":
+		url = addPrefix(host)
+		var err error
+		body, err = json.Marshal(jsonRPCRequest{
+			JSONRPC: "2.0",
+			ID:      rpcIDValue(opts.RPCID),
+			Method:  "net_info",
+			Params:  map[string]any{},
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown rpc mode %q", opts.RPCMode)
+	}
+	if opts.RPCBody != "" {
+		body = []byte(opts.RPCBody)
+	}
+
+	var reqBody io.Reader
+	if opts.RPCMethod == http.MethodPost {
+		reqBody = bytes.NewReader(body)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, opts.RPCMethod, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error building net_info request for %s: %w", host, err)
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching net_info from target host %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+
+	var readTimedOut atomic.Bool
+	if opts.ReadTimeout > 0 {
+		timer := time.AfterFunc(opts.ReadTimeout, func() {
+			readTimedOut.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if readTimedOut.Load() {
+			return nil, fmt.Errorf("error reading response body from %s: read timeout of %s exceeded", host, opts.ReadTimeout)
+		}
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return respBody, nil
+}
+
+// newRPCClient returns an HTTP client for net_info requests. opts.Timeout
+// bounds each whole request; ConnectTimeout, TLSHandshakeTimeout and
+// ReadTimeout, where set, bound the individual stages.
+func newRPCClient(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   opts.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.ReadTimeout > 0 {
+		transport.ResponseHeaderTimeout = opts.ReadTimeout
+	}
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}
+}
+
+// fetchStats describes the net_info responses behind a run.
+type fetchStats struct {
+	responseBytes int64               // summed body length
+	peers         int                 // summed peer count, before merging hosts
+	listeners     map[string][]string // each host's own listen addresses
+}
+
+// bytesPerPeer returns the average response size per reported peer.
+func (s fetchStats) bytesPerPeer() float64 {
+	if s.peers == 0 {
+		return 0
+	}
+	return float64(s.responseBytes) / float64(s.peers)
+}
+
+// fetchPeers fetches and parses the peers reported by one host, or read
+// from one file with opts.FromFiles. Under opts.Strict a peer that fails
+// to parse yields a *peerParseError.
+func fetchPeers(ctx context.Context, host string, opts Options) ([]peerWithBytes, fetchStats, error) {
+	var body []byte
+	var err error
+	if len(opts.FromFiles) > 0 {
+		body, err = readNetInfoFile(host)
+	} else {
+		body, err = fetchNetInfo(ctx, host, opts)
+	}
+	if err != nil {
+		return nil, fetchStats{}, err
+	}
+
+	netInfo, id, err := decodeNetInfo(body, opts.Lean)
+	if err != nil {
+		return nil, fetchStats{}, fmt.Errorf("error unmarshaling JSON from %s: %w", host, err)
+	}
+	if opts.RPCMode == "jsonrpc" && opts.RPCBody == "" && len(opts.FromFiles) == 0 {
+		if err := checkRPCID(id, opts.RPCID); err != nil {
+			return nil, fetchStats{}, fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	peers := netInfo.Peers
+	stats := fetchStats{
+		responseBytes: int64(len(body)),
+		peers:         len(peers),
+		listeners:     map[string][]string{host: netInfo.Listeners},
+	}
+	log.Debugf("net_info from %s: %d bytes for %d peers (%.0f bytes/peer)", host, stats.responseBytes, stats.peers, stats.bytesPerPeer())
+
+	peersWithBytes := make([]peerWithBytes, 0, len(peers))
+	for _, p := range peers {
+		pwb, err := newPeerWithBytes(p, opts.DefaultP2PPort, opts.ChannelWeights)
+		if err != nil && opts.Strict {
+			return nil, fetchStats{}, &peerParseError{host: host, peer: p, err: err}
+		}
+		if opts.NoResolve {
+			pwb.address = p.NodeInfo.ListenAddr
+		}
+		pwb.sources = []string{host}
+		peersWithBytes = append(peersWithBytes, pwb)
+	}
+	return peersWithBytes, stats, nil
+}
+
+// peerParseError reports a peer whose fields could not be parsed.
+type peerParseError struct {
+	host string
+	peer Peer
+	err  error
+}
+
+func (e *peerParseError) Error() string {
+	return fmt.Sprintf("error parsing peer %s (%s) from %s: %v", e.peer.NodeInfo.DefaultNodeID, e.peer.RemoteIP, e.host, e.err)
+}
+
+func (e *peerParseError) Unwrap() error { return e.err }
+
+// fetchAllPeers queries every host concurrently and merges their peers.
+// Hosts that fail are logged and skipped, but the run fails if fewer than
+// minSuccess of them (as a fraction) or none at all succeed, or if any
+// host reports a peer parse error. The stats cover the hosts that answered.
+func fetchAllPeers(ctx context.Context, hosts []string, minSuccess float64, opts Options) ([]peerWithBytes, fetchStats, error) {
+	type hostResult struct {
+		peers []peerWithBytes
+		stats fetchStats
+		err   error
+	}
+	results := make([]hostResult, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].peers, results[i].stats, results[i].err = fetchPeers(ctx, host, opts)
+		}()
+	}
+	wg.Wait()
+
+	if len(hosts) == 1 {
+		return results[0].peers, results[0].stats, results[0].err
+	}
+
+	var perHost [][]peerWithBytes
+	var stats fetchStats
+	for i, r := range results {
+		var parseErr *peerParseError
+		if errors.As(r.err, &parseErr) {
+			return nil, fetchStats{}, r.err
+		}
+		if r.err != nil {
+			log.Warnf("Skipping host %s: %v", hosts[i], r.err)
+			continue
+		}
+		perHost = append(perHost, r.peers)
+		stats.responseBytes += r.stats.responseBytes
+		stats.peers += r.stats.peers
+		if stats.listeners == nil {
+			stats.listeners = make(map[string][]string)
+		}
+		maps.Copy(stats.listeners, r.stats.listeners)
+	}
+
+	succeeded := len(perHost)
+	if succeeded == 0 {
+		return nil, fetchStats{}, fmt.Errorf("all %d hosts failed", len(hosts))
+	}
+	if ratio := float64(succeeded) / float64(len(hosts)); ratio < minSuccess {
+		return nil, fetchStats{}, fmt.Errorf("only %d of %d hosts succeeded, below -min-host-success %.2f", succeeded, len(hosts), minSuccess)
+	}
+	return mergePeers(perHost), stats, nil
+}
+
+// mergePeers combines the peers seen by several hosts. A peer reported by
+// more than one host, identified by node ID, appears once with its bytes,
+// rate and recently-sent counts summed and its longest connection
+// duration, and lists every host that reported it. The remaining fields
+// come from the first host that saw it.
+func mergePeers(perHost [][]peerWithBytes) []peerWithBytes {
+	var merged []peerWithBytes
+	index := make(map[string]int)
+	for _, peers := range perHost {
+		for _, p := range peers {
+			id := p.peer.NodeInfo.DefaultNodeID
+			i, ok := index[id]
+			if !ok {
+				index[id] = len(merged)
+				merged = append(merged, p)
+				continue
+			}
+			m := &merged[i]
+			m.totalBytes += p.totalBytes
+			m.curRate += p.curRate
+			m.sendRate += p.sendRate
+			m.recentSent += p.recentSent
+			m.samples += p.samples
+			m.weighted += p.weighted
+			m.duration = max(m.duration, p.duration)
+			m.sources = append(m.sources, p.sources...)
+		}
+	}
+	return merged
+}
+
+// decodeNetInfo decodes the result and the JSON-RPC id of a net_info
+// response, using the reduced lean structs if lean is set.
+func decodeNetInfo(body []byte, lean bool) (ResultNetInfo, any, error) {
+	if lean {
+		return decodeNetInfoLean(body)
+	}
+	var netInfoRes CometBFTNetInfoResult
+	if err := json.Unmarshal(body, &netInfoRes); err != nil {
+		return ResultNetInfo{}, nil, err
+	}
+	return netInfoRes.Result, netInfoRes.ID, nil
+}
+
+// rpcIDValue returns id as a JSON number if it is an integer and as a
+// string otherwise.
+func rpcIDValue(id string) any {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+// checkRPCID reports an error if the id of a JSON-RPC response does not
+// match the id that was sent.
+func checkRPCID(got any, want string) error {
+	if fmt.Sprint(got) != fmt.Sprint(rpcIDValue(want)) {
+		return fmt.Errorf("json-rpc response id %v does not match request id %s", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingHost starts an RPC stub that answers every request with 500 and
+// returns its URL.
+func failingHost(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestMinHostSuccess(t *testing.T) {
+	good := serveNetInfo(t, testPeer(1, "a", 10, 10))
+	hosts := []string{good, failingHost(t), failingHost(t)}
+
+	_, err := SelectTopPeers(context.Background(), Options{Hosts: hosts, MinHostSuccess: 0.5})
+	if err == nil || !strings.Contains(err.Error(), "only 1 of 3 hosts succeeded") {
+		t.Errorf("1 of 3 hosts with -min-host-success 0.5: err = %v, want the run aborted", err)
+	}
+
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: hosts, MinHostSuccess: 0.3})
+	if err != nil {
+		t.Fatalf("1 of 3 hosts with -min-host-success 0.3: %v", err)
+	}
+	if len(res.Peers) != 1 {
+		t.Errorf("selected %d peers, want the 1 the good host reported", len(res.Peers))
+	}
+
+	if err := (Options{MinHostSuccess: 1.5}).Validate(); err == nil {
+		t.Error("min host success 1.5 was accepted")
+	}
+}
+
+func TestStrictMalformedPeer(t *testing.T) {
+	bad := testPeer(2, "bad", 5, 5)
+	bad.ConnectionStatus.SendMonitor.Bytes = "lots"
+	host := serveNetInfo(t, testPeer(1, "good", 10, 10), bad)
+
+	_, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, Strict: true})
+	var parseErr *peerParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("malformed peer under -strict: err = %v, want a peer parse error", err)
+	}
+	if parseErr.peer.NodeInfo.Moniker != "bad" {
+		t.Errorf("parse error names peer %q, want bad", parseErr.peer.NodeInfo.Moniker)
+	}
+
+	if _, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}}); err != nil {
+		t.Errorf("malformed peer without -strict: %v", err)
+	}
+}
+
+// serveJSONRPC starts an RPC stub that answers every request with a
+// net_info response listing peers under the given JSON-RPC id, and
+// returns its URL and a function returning the last request body.
+func serveJSONRPC(t *testing.T, id any, peers ...Peer) (string, func() string) {
+	t.Helper()
+	var resp CometBFTNetInfoResult
+	if err := json.Unmarshal(netInfoBody(t, peers...), &resp); err != nil {
+		t.Fatal(err)
+	}
+	resp.ID = id
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var last string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = string(req)
+		mu.Unlock()
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestRPCIDMismatch(t *testing.T) {
+	host, lastRequest := serveJSONRPC(t, 7, testPeer(1, "a", 10, 10))
+	_, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, RPCMode: "jsonrpc", RPCID: "3"})
+	if err == nil || !strings.Contains(err.Error(), "does not match request id 3") {
+		t.Errorf("response id 7 for request id 3: err = %v, want an id mismatch", err)
+	}
+	var req map[string]any
+	if err := json.Unmarshal([]byte(lastRequest()), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req["id"] != 3.0 {
+		t.Errorf("request id = %v, want 3", req["id"])
+	}
+
+	if _, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, RPCMode: "jsonrpc", RPCID: "7"}); err != nil {
+		t.Errorf("matching id 7: %v", err)
+	}
+}
+
+func TestRPCCustomBody(t *testing.T) {
+	host, lastRequest := serveJSONRPC(t, "custom", testPeer(1, "a", 10, 10), testPeer(2, "b", 20, 20))
+	const body = `{"jsonrpc":"2.0","id":"custom","method":"net_info","params":{"gateway":"x"}}`
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, RPCMethod: "post", RPCBody: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastRequest(); got != body {
+		t.Errorf("request body = %q, want %q", got, body)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "b,a" {
+		t.Errorf("selected %s, want b,a from the response", got)
+	}
+}
+
+func TestValidateRPCMethod(t *testing.T) {
+	for _, o := range []Options{
+		{RPCBody: "{}"},
+		{RPCMode: "jsonrpc", RPCMethod: "GET"},
+		{RPCMethod: "PUT"},
+	} {
+		if err := o.Validate(); err == nil {
+			t.Errorf("method %q, mode %q and body %q were accepted", o.RPCMethod, o.RPCMode, o.RPCBody)
+		}
+	}
+}
+
+func TestResponseBytesPerPeer(t *testing.T) {
+	peers := []Peer{testPeer(1, "a", 10, 10), testPeer(2, "b", 5, 5), testPeer(3, "c", 1, 1), testPeer(4, "d", 0, 0)}
+	size := len(netInfoBody(t, peers...))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{serveNetInfo(t, peers...)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Aggregates.ResponseBytes != int64(size) {
+		t.Errorf("response bytes = %d, want %d", res.Aggregates.ResponseBytes, size)
+	}
+	if want := float64(size) / 4; res.Aggregates.BytesPerPeer != want {
+		t.Errorf("bytes per peer = %g, want %g", res.Aggregates.BytesPerPeer, want)
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// The listener accepts connections but never answers the ClientHello.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	start := time.Now()
+	_, err = fetchNetInfo(context.Background(), "https://"+lis.Addr().String(), Options{
+		Timeout:             10 * time.Second,
+		TLSHandshakeTimeout: 100 * time.Millisecond,
+	}.withDefaults())
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake timeout") {
+		t.Fatalf("err = %v, want a TLS handshake timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the fetch failed after %s, want the handshake timeout well before the overall timeout", elapsed)
+	}
+}
+
+func TestFromFilesMerge(t *testing.T) {
+	a := writeNetInfo(t, testPeer(1, "shared", 10, 10), testPeer(2, "only-a", 50, 50))
+	b := writeNetInfo(t, testPeer(1, "shared", 100, 100), testPeer(3, "only-b", 1, 1))
+	res, err := SelectTopPeers(context.Background(), Options{FromFiles: []string{a, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "shared,only-a,only-b" {
+		t.Fatalf("selected %s, want the three distinct peers by merged bytes", got)
+	}
+	shared := res.Peers[0]
+	if shared.TotalBytes != 220 {
+		t.Errorf("shared peer has %d bytes, want both files' 220", shared.TotalBytes)
+	}
+	if want := []string{a, b}; !slices.Equal(shared.SourceHosts, want) {
+		t.Errorf("shared peer sources = %v, want %v", shared.SourceHosts, want)
+	}
+}
+
+func TestSourceHosts(t *testing.T) {
+	a := serveNetInfo(t, testPeer(1, "shared", 10, 10), testPeer(2, "only-a", 5, 5))
+	b := serveNetInfo(t, testPeer(1, "shared", 20, 20))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{a, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string][]string)
+	for _, p := range res.Peers {
+		sources[p.Moniker] = slices.Sorted(slices.Values(p.SourceHosts))
+	}
+	want := []string{a, b}
+	slices.Sort(want)
+	if !slices.Equal(sources["shared"], want) {
+		t.Errorf("shared peer sources = %v, want both hosts %v", sources["shared"], want)
+	}
+	if !slices.Equal(sources["only-a"], []string{a}) {
+		t.Errorf("only-a sources = %v, want %v", sources["only-a"], []string{a})
+	}
+
+	out, err := Format(res, Options{OutputFormat: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []PeerRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Sorted(slices.Values(records[0].SourceHosts)); !slices.Equal(got, want) {
+		t.Errorf("JSON source_hosts of the shared peer = %v, want %v", got, want)
+	}
+}
+
+func TestNoResolve(t *testing.T) {
+	unspecified := testPeer(1, "unspecified", 10, 10)
+	unspecified.NodeInfo.ListenAddr = "tcp://0.0.0.0:26656"
+	bare := testPeer(2, "bare", 5, 5)
+	bare.NodeInfo.ListenAddr = "10.0.0.2"
+	host := serveNetInfo(t, unspecified, bare)
+
+	for noResolve, want := range map[bool]string{
+		false: testID("1") + "@10.0.0.1:26656," + testID("2") + "@10.0.0.2:26656",
+		true:  testID("1") + "@tcp://0.0.0.0:26656," + testID("2") + "@10.0.0.2",
+	} {
+		opts := Options{Hosts: []string{host}, NoResolve: noResolve}
+		res, err := SelectTopPeers(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Format(res, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("no-resolve %v: output %q, want %q", noResolve, out, want)
+		}
+	}
+}
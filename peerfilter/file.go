@@ -0,0 +1,37 @@
+package peerfilter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// expandFiles resolves the paths and glob patterns of Options.FromFiles
+// into a sorted list of files, without duplicates. A pattern that matches
+// nothing is an error, so a typo does not silently shrink the input.
+func expandFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no net_info files match %q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// readNetInfoFile reads a saved net_info response, e.g. one captured with
+// curl from a sentry's /net_info endpoint.
+func readNetInfoFile(path string) ([]byte, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading net_info file: %w", err)
+	}
+	return body, nil
+}
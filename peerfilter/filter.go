@@ -0,0 +1,198 @@
+package peerfilter
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// peerFilter is a named predicate reporting whether a peer should be kept.
+// The name keys the drop counts in Aggregates.FilterDrops.
+type peerFilter struct {
+	name string
+	keep func(p peerWithBytes) bool
+}
+
+// versionPattern matches the release versions accepted by
+// Options.RequireVersion: major.minor, an optional patch and an optional
+// pre-release or build suffix.
+var versionPattern = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?([-+.][0-9A-Za-z.+-]*)?$`)
+
+// peerFilters returns the filters enabled by opts, applied in order.
+func peerFilters(opts Options) ([]peerFilter, error) {
+	var filters []peerFilter
+	if opts.Network != "" {
+		filters = append(filters, peerFilter{"network", func(p peerWithBytes) bool {
+			network := p.peer.NodeInfo.Network
+			return network == "" || network == opts.Network
+		}})
+	}
+	if opts.DropZeroBytes {
+		filters = append(filters, peerFilter{"drop-zero-bytes", func(p peerWithBytes) bool {
+			return p.totalBytes != 0
+		}})
+	}
+	if opts.MinRecentSent > 0 {
+		filters = append(filters, peerFilter{"min-recent-sent", func(p peerWithBytes) bool {
+			return p.recentSent >= opts.MinRecentSent
+		}})
+	}
+	if opts.MaxPeerAge > 0 {
+		filters = append(filters, peerFilter{"max-peer-age", func(p peerWithBytes) bool {
+			return p.duration <= opts.MaxPeerAge
+		}})
+	}
+	if opts.Denylist != nil {
+		filters = append(filters, peerFilter{"denylist", func(p peerWithBytes) bool {
+			return !opts.Denylist.denied(p.peer.NodeInfo.DefaultNodeID)
+		}})
+	}
+	if opts.FailMemory != nil {
+		now := time.Now()
+		filters = append(filters, peerFilter{"fail-memory", func(p peerWithBytes) bool {
+			return !opts.FailMemory.cooling(p.peer.NodeInfo.DefaultNodeID, now)
+		}})
+	}
+	if opts.RequireTxIndex {
+		filters = append(filters, peerFilter{"require-txindex", func(p peerWithBytes) bool {
+			return p.peer.NodeInfo.Other.TxIndex == "on"
+		}})
+	}
+	if opts.SkipPortMismatch {
+		filters = append(filters, peerFilter{"skip-port-mismatch", func(p peerWithBytes) bool {
+			return !portMismatch(p)
+		}})
+	}
+	if opts.RequireVersion {
+		filters = append(filters, peerFilter{"require-version", func(p peerWithBytes) bool {
+			return versionPattern.MatchString(p.peer.NodeInfo.Version)
+		}})
+	}
+	if len(opts.ExcludeVersions) > 0 {
+		filters = append(filters, peerFilter{"exclude-version", func(p peerWithBytes) bool {
+			return !matchesAny(opts.ExcludeVersions, p.peer.NodeInfo.Version)
+		}})
+	}
+	if opts.VersionRegex != "" {
+		re, err := regexp.Compile(opts.VersionRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version regex: %w", err)
+		}
+		filters = append(filters, peerFilter{"version-regex", func(p peerWithBytes) bool {
+			return re.MatchString(p.peer.NodeInfo.Version)
+		}})
+	}
+	if len(opts.CompatMatrix) > 0 {
+		filters = append(filters, peerFilter{"compat-matrix", func(p peerWithBytes) bool {
+			v := p.peer.NodeInfo.ProtocolVersion
+			if !compatible(opts.CompatMatrix, v) {
+				log.Debugf("Peer %s protocol block=%s app=%s does not satisfy the compatibility matrix", p.peer.NodeInfo.DefaultNodeID, v.Block, v.App)
+				return false
+			}
+			return true
+		}})
+	}
+	if len(opts.SybilPatterns) > 0 {
+		patterns := make([]*regexp.Regexp, 0, len(opts.SybilPatterns))
+		for _, pattern := range opts.SybilPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sybil pattern %q: %w", pattern, err)
+			}
+			patterns = append(patterns, re)
+		}
+		filters = append(filters, peerFilter{"sybil-patterns", func(p peerWithBytes) bool {
+			for _, re := range patterns {
+				if re.MatchString(p.peer.NodeInfo.Moniker) {
+					log.Debugf("Peer %s moniker %q matches Sybil pattern %s", p.peer.NodeInfo.DefaultNodeID, p.peer.NodeInfo.Moniker, re)
+					return false
+				}
+			}
+			return true
+		}})
+	}
+	return filters, nil
+}
+
+// logVersions logs how many peers run each software version, most common
+// first. level is the logrus level to log at.
+func logVersions(peers []peerWithBytes, level log.Level) {
+	if !log.IsLevelEnabled(level) {
+		return
+	}
+	counts := make(map[string]int)
+	for _, p := range peers {
+		counts[p.peer.NodeInfo.Version]++
+	}
+	versions := make([]string, 0, len(counts))
+	for v := range counts {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if counts[versions[i]] != counts[versions[j]] {
+			return counts[versions[i]] > counts[versions[j]]
+		}
+		return versions[i] < versions[j]
+	})
+	parts := make([]string, 0, len(versions))
+	for _, v := range versions {
+		label := v
+		if label == "" {
+			label = "unknown"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", label, counts[v]))
+	}
+	log.StandardLogger().Logf(level, "Peer versions: %s", strings.Join(parts, ", "))
+}
+
+// matchesAny reports whether s matches one of the path.Match patterns.
+// Malformed patterns never match; Options.Validate rejects them.
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPeers returns the peers accepted by every filter, and how many
+// peers each filter dropped. A peer is counted only against the first
+// filter that rejects it.
+func filterPeers(peers []peerWithBytes, filters []peerFilter) ([]peerWithBytes, map[string]int) {
+	var kept []peerWithBytes
+	drops := make(map[string]int, len(filters))
+	for _, f := range filters {
+		drops[f.name] = 0
+	}
+next:
+	for _, p := range peers {
+		for _, f := range filters {
+			if !f.keep(p) {
+				drops[f.name]++
+				continue next
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept, drops
+}
+
+// checkPassRatio warns when fewer than minRatio of the peers passed the
+// filters. It reports whether the warning was emitted.
+func checkPassRatio(passed, total int, minRatio float64) bool {
+	if total == 0 || minRatio <= 0 {
+		return false
+	}
+	ratio := float64(passed) / float64(total)
+	if ratio >= minRatio {
+		return false
+	}
+	log.Warnf("Only %d of %d peers (%.0f%%) passed the filters; filters may be too strict",
+		passed, total, ratio*100)
+	return true
+}
@@ -0,0 +1,182 @@
+package peerfilter
+
+import (
+	"context"
+	"github.com/sirupsen/logrus/hooks/test"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keptMonikers returns the monikers of the peers that pass the filters
+// enabled by opts.
+func keptMonikers(t *testing.T, opts Options, peers ...Peer) []string {
+	t.Helper()
+	filters, err := peerFilters(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := filterPeers(parsedPeers(t, peers...), filters)
+	return rankedMonikers(kept)
+}
+
+func TestCheckPassRatio(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	host := serveNetInfo(t,
+		testPeer(1, "a", 100, 100),
+		testPeer(2, "b", 0, 0),
+		testPeer(3, "c", 0, 0),
+		testPeer(4, "d", 0, 0),
+	)
+	_, err := SelectTopPeers(context.Background(), Options{
+		Hosts:         []string{host},
+		TopPeers:      1,
+		DropZeroBytes: true,
+		MinPassRatio:  0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned bool
+	for _, e := range hook.AllEntries() {
+		if strings.Contains(e.Message, "1 of 4 peers") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("1 of 4 peers passing did not warn with a minimum pass ratio of 0.5")
+	}
+
+	if checkPassRatio(3, 4, 0.5) {
+		t.Error("3 of 4 peers passing warned with a minimum pass ratio of 0.5")
+	}
+}
+
+func TestDropZeroBytes(t *testing.T) {
+	peers := []Peer{testPeer(1, "busy", 10, 0), testPeer(2, "silent", 0, 0), testPeer(3, "receiving", 0, 5)}
+	if got := strings.Join(keptMonikers(t, Options{DropZeroBytes: true}, peers...), ","); got != "busy,receiving" {
+		t.Errorf("kept %s, want busy,receiving", got)
+	}
+	if got := keptMonikers(t, Options{}, peers...); len(got) != 3 {
+		t.Errorf("kept %v without -drop-zero-bytes, want all 3 peers", got)
+	}
+}
+
+func TestMinRecentSent(t *testing.T) {
+	idle := testPeer(2, "idle", 1000, 1000)
+	idle.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x40, RecentlySent: "0"}}
+	got := keptMonikers(t, Options{MinRecentSent: 5}, testPeer(1, "active", 10, 10), idle)
+	if strings.Join(got, ",") != "active" {
+		t.Errorf("kept %v, want only the active peer", got)
+	}
+}
+
+func TestExcludeVersions(t *testing.T) {
+	old := testPeer(2, "old", 10, 10)
+	old.NodeInfo.Version = "0.37.4"
+	rc := testPeer(3, "rc", 10, 10)
+	rc.NodeInfo.Version = "0.38.0-rc1"
+	got := keptMonikers(t, Options{ExcludeVersions: []string{"0.37.4", "*-rc*"}}, testPeer(1, "current", 10, 10), old, rc)
+	if strings.Join(got, ",") != "current" {
+		t.Errorf("kept %v, want only the peer on an allowed version", got)
+	}
+}
+
+func TestRequireTxIndex(t *testing.T) {
+	off := testPeer(2, "off", 10, 10)
+	off.NodeInfo.Other.TxIndex = "off"
+	got := keptMonikers(t, Options{RequireTxIndex: true}, testPeer(1, "on", 10, 10), off)
+	if strings.Join(got, ",") != "on" {
+		t.Errorf("kept %v, want only the peer indexing transactions", got)
+	}
+}
+
+func TestVersionRegex(t *testing.T) {
+	old := testPeer(2, "old", 10, 10)
+	old.NodeInfo.Version = "0.34.29"
+	got := keptMonikers(t, Options{VersionRegex: `^0\.38\.`}, testPeer(1, "current", 10, 10), old)
+	if strings.Join(got, ",") != "current" {
+		t.Errorf("kept %v, want only the peer matching the version regex", got)
+	}
+	if _, err := peerFilters(Options{VersionRegex: "(0.38"}); err == nil {
+		t.Error("an invalid version regex was accepted")
+	}
+}
+
+func TestMaxPeerAge(t *testing.T) {
+	old := testPeer(2, "old", 10, 10)
+	old.ConnectionStatus.Duration = "86400000000000"
+	got := keptMonikers(t, Options{MaxPeerAge: 2 * time.Hour}, testPeer(1, "fresh", 10, 10), old)
+	if strings.Join(got, ",") != "fresh" {
+		t.Errorf("kept %v, want only the peer connected for less than 2h", got)
+	}
+}
+
+func TestFilterDrops(t *testing.T) {
+	silent := testPeer(2, "silent", 0, 0)
+	// Both zero bytes and off-network: only the first filter counts it.
+	silentOther := testPeer(3, "silent-other", 0, 0)
+	silentOther.NodeInfo.Network = "othernet-2"
+	other := testPeer(4, "other", 10, 10)
+	other.NodeInfo.Network = "othernet-2"
+	noIndex := testPeer(5, "no-index", 10, 10)
+	noIndex.NodeInfo.Other.TxIndex = "off"
+	host := serveNetInfo(t, testPeer(1, "good", 10, 10), silent, silentOther, other, noIndex)
+
+	res, err := SelectTopPeers(context.Background(), Options{
+		Hosts:          []string{host},
+		Network:        "testnet-1",
+		DropZeroBytes:  true,
+		RequireTxIndex: true,
+		MinRecentSent:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"network": 2, "drop-zero-bytes": 1, "min-recent-sent": 0, "require-txindex": 1}
+	if !maps.Equal(res.Aggregates.FilterDrops, want) {
+		t.Errorf("filter drops = %v, want %v", res.Aggregates.FilterDrops, want)
+	}
+	if res.Aggregates.PassedPeers != 1 {
+		t.Errorf("%d peers passed, want 1", res.Aggregates.PassedPeers)
+	}
+}
+
+func TestSybilPatterns(t *testing.T) {
+	peers := []Peer{testPeer(1, "validator-eu", 10, 10), testPeer(2, "node-4411", 10, 10), testPeer(3, "Spammer", 10, 10)}
+	got := keptMonikers(t, Options{SybilPatterns: []string{`^node-\d+$`, `(?i)spam`}}, peers...)
+	if strings.Join(got, ",") != "validator-eu" {
+		t.Errorf("kept %v, want only the moniker matching no pattern", got)
+	}
+	if _, err := peerFilters(Options{SybilPatterns: []string{"[z-a]"}}); err == nil {
+		t.Error("an invalid sybil pattern was accepted")
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	empty := testPeer(2, "empty", 10, 10)
+	empty.NodeInfo.Version = ""
+	garbage := testPeer(3, "garbage", 10, 10)
+	garbage.NodeInfo.Version = "<script>"
+	prefixed := testPeer(4, "prefixed", 10, 10)
+	prefixed.NodeInfo.Version = "v0.38.12-rc1+abc"
+	peers := []Peer{testPeer(1, "current", 10, 10), empty, garbage, prefixed}
+
+	filters, err := peerFilters(Options{RequireVersion: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, drops := filterPeers(parsedPeers(t, peers...), filters)
+	if got := strings.Join(rankedMonikers(kept), ","); got != "current,prefixed" {
+		t.Errorf("kept %s, want current,prefixed", got)
+	}
+	if drops["require-version"] != 2 {
+		t.Errorf("require-version dropped %d peers, want 2", drops["require-version"])
+	}
+	if got := keptMonikers(t, Options{}, peers...); len(got) != 4 {
+		t.Errorf("kept %v without -require-version, want all 4 peers", got)
+	}
+}
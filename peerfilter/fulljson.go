@@ -0,0 +1,85 @@
+package peerfilter
+
+import "encoding/json"
+
+// FullDump is the document of -output-format=full-json: the options a
+// run used, its metadata and aggregates, what each filter dropped, and
+// every peer that passed the filters in rank order with all its parsed
+// fields.
+type FullDump struct {
+	Config     Options      `json:"config"`
+	Metadata   Metadata     `json:"metadata"`
+	Aggregates Aggregates   `json:"aggregates"`
+	Filters    []FilterDrop `json:"filters"`
+	Peers      []FullPeer   `json:"peers"`
+	Alerts     []SLAAlert   `json:"alerts,omitempty"`
+}
+
+// FullPeer is one ranked peer of a FullDump.
+type FullPeer struct {
+	PeerRecord
+	Score          float64 `json:"score"`
+	Selected       bool    `json:"selected"`
+	CurRate        int64   `json:"cur_rate"`
+	SendRate       int64   `json:"send_rate"`
+	RecentSent     int64   `json:"recent_sent"`
+	WeightedSent   float64 `json:"weighted_recent_sent"`
+	Samples        int64   `json:"samples"`
+	Delta          int64   `json:"delta"`
+	Stability      float64 `json:"stability"`
+	Rates          []int64 `json:"rates,omitempty"`
+	AvgRate        float64 `json:"avg_rate"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+	Channels       []int   `json:"channels"`
+	RemotePort     string  `json:"remote_port,omitempty"`
+	LatencySeconds float64 `json:"latency_seconds,omitempty"`
+}
+
+// FullDump returns everything r computed, with opts as its config.
+func (r *Result) FullDump(opts Options) FullDump {
+	audit := r.Audit()
+	d := FullDump{
+		Config:     opts,
+		Metadata:   r.Metadata,
+		Aggregates: r.Aggregates,
+		Filters:    audit.Filters,
+		Peers:      make([]FullPeer, 0, len(r.passed)),
+		Alerts:     r.Alerts,
+	}
+	for i, p := range r.passed {
+		rec := newPeerRecord(p)
+		cs := p.peer.ConnectionStatus
+		rec.ConnectionStatus = &cs
+		channels := make([]int, 0, len(p.channels))
+		for _, c := range p.channels {
+			channels = append(channels, int(c))
+		}
+		d.Peers = append(d.Peers, FullPeer{
+			PeerRecord:     rec,
+			Score:          p.score,
+			Selected:       audit.Ranked[i].Selected,
+			CurRate:        p.curRate,
+			SendRate:       p.sendRate,
+			RecentSent:     p.recentSent,
+			WeightedSent:   p.weighted,
+			Samples:        p.samples,
+			Delta:          p.delta,
+			Stability:      p.stability,
+			Rates:          p.rates,
+			AvgRate:        p.avgRate,
+			IdleSeconds:    p.idle.Seconds(),
+			Channels:       channels,
+			RemotePort:     p.remotePort,
+			LatencySeconds: p.latency.Seconds(),
+		})
+	}
+	return d
+}
+
+func formatFullJSON(res *Result, opts Options) (string, error) {
+	out, err := json.MarshalIndent(res.FullDump(opts), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
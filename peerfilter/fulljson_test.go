@@ -0,0 +1,68 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatFullJSON(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "a", 30, 30), testPeer(2, "b", 20, 20), testPeer(3, "zero", 0, 0))
+	opts := Options{
+		Hosts:         []string{host},
+		TopPeers:      1,
+		DropZeroBytes: true,
+		OutputFormat:  "full-json",
+		Flags:         map[string]string{"interval": "1m0s", "output-file": "peers.json"},
+	}
+	res, err := SelectTopPeers(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Format(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("full-json output is not a JSON object: %v", err)
+	}
+	for _, key := range []string{"config", "metadata", "aggregates", "filters", "peers"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("full-json output has no %q key", key)
+		}
+	}
+
+	var dump struct {
+		Config struct {
+			TopPeers int               `json:"top_peers"`
+			Flags    map[string]string `json:"flags"`
+		} `json:"config"`
+		Aggregates Aggregates   `json:"aggregates"`
+		Filters    []FilterDrop `json:"filters"`
+		Peers      []FullPeer   `json:"peers"`
+	}
+	if err := json.Unmarshal([]byte(out), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Config.TopPeers != 1 || dump.Config.Flags["interval"] != "1m0s" {
+		t.Errorf("config = %+v, want top_peers 1 and the CLI flags", dump.Config)
+	}
+	if dump.Aggregates.TotalPeers != 3 || dump.Aggregates.PassedPeers != 2 {
+		t.Errorf("aggregates = %+v, want 3 peers of which 2 passed", dump.Aggregates)
+	}
+	if len(dump.Filters) != 1 || dump.Filters[0] != (FilterDrop{Name: "drop-zero-bytes", Dropped: 1}) {
+		t.Errorf("filters = %+v, want drop-zero-bytes dropping 1", dump.Filters)
+	}
+	if len(dump.Peers) != 2 {
+		t.Fatalf("got %d peers, want the 2 that passed", len(dump.Peers))
+	}
+	first, second := dump.Peers[0], dump.Peers[1]
+	if first.Moniker != "a" || first.Rank != 1 || !first.Selected || second.Selected {
+		t.Errorf("peers = %+v, want a ranked first and the only one selected", dump.Peers)
+	}
+	if first.ConnectionStatus == nil || len(first.Channels) != 2 {
+		t.Errorf("peer a lacks its parsed fields: %+v", first)
+	}
+}
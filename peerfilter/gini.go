@@ -0,0 +1,25 @@
+package peerfilter
+
+import "sort"
+
+// gini returns the Gini coefficient of values: 0 when they are all equal
+// and close to 1 when one value holds the whole total. It is 0 for an
+// empty or all-zero input. Negative values are treated as zero.
+func gini(values []int64) float64 {
+	sorted := make([]float64, len(values))
+	var total float64
+	for i, v := range values {
+		sorted[i] = float64(max(v, 0))
+		total += sorted[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Float64s(sorted)
+	var weighted float64
+	for i, v := range sorted {
+		weighted += float64(i+1) * v
+	}
+	n := float64(len(sorted))
+	return 2*weighted/(n*total) - (n+1)/n
+}
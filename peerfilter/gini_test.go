@@ -0,0 +1,30 @@
+package peerfilter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGini(t *testing.T) {
+	uniform := []int64{500, 500, 500, 500}
+	if got := gini(uniform); math.Abs(got) > 1e-9 {
+		t.Errorf("gini of a uniform distribution = %g, want 0", got)
+	}
+
+	// One peer of 100 carries all the traffic: the coefficient is
+	// (n-1)/n, which tends to 1.
+	concentrated := make([]int64, 100)
+	concentrated[42] = 1 << 30
+	if got := gini(concentrated); math.Abs(got-0.99) > 1e-9 {
+		t.Errorf("gini of a fully concentrated distribution = %g, want 0.99", got)
+	}
+
+	if got := gini([]int64{10, 30}); math.Abs(got-0.25) > 1e-9 {
+		t.Errorf("gini(10, 30) = %g, want 0.25", got)
+	}
+	for _, values := range [][]int64{nil, {0, 0}} {
+		if got := gini(values); got != 0 {
+			t.Errorf("gini(%v) = %g, want 0", values, got)
+		}
+	}
+}
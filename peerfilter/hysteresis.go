@@ -0,0 +1,62 @@
+package peerfilter
+
+// Hysteresis dampens churn in the selected peer set across repeated runs.
+// A previously selected peer stays in the output, in place of a newcomer
+// from the top N, until it has ranked below position TopPeers+Margin for
+// Intervals consecutive runs (at least one). Peers that disappear or
+// fail the filters are dropped at once.
+type Hysteresis struct {
+	Margin    int `json:"margin"`
+	Intervals int `json:"intervals"`
+
+	selected map[string]bool // node IDs in the previous output
+	misses   map[string]int  // consecutive runs spent beyond the margin
+}
+
+// apply picks n peers from the ranked list, preferring peers selected in
+// the previous run, and records the outcome for the next run. The result
+// is in rank order.
+func (h *Hysteresis) apply(ranked []peerWithBytes, n int) []peerWithBytes {
+	keep := max(h.Intervals, 1)
+	misses := make(map[string]int)
+	retained := make(map[string]bool)
+	free := n
+	for rank, p := range ranked {
+		id := p.peer.NodeInfo.DefaultNodeID
+		if !h.selected[id] {
+			continue
+		}
+		if rank < n {
+			free--
+			continue
+		}
+		if rank >= n+h.Margin {
+			misses[id] = h.misses[id] + 1
+		}
+		if misses[id] < keep {
+			retained[id] = true
+			free--
+		}
+	}
+
+	// Newcomers fill whatever slots previously selected peers leave.
+	selected := make([]peerWithBytes, 0, n)
+	next := make(map[string]bool, n)
+	for rank, p := range ranked {
+		id := p.peer.NodeInfo.DefaultNodeID
+		switch {
+		case retained[id]:
+		case rank < n && h.selected[id]:
+		case rank < n && free > 0:
+			free--
+		default:
+			continue
+		}
+		selected = append(selected, p)
+		next[id] = true
+	}
+
+	h.selected = next
+	h.misses = misses
+	return selected
+}
@@ -0,0 +1,40 @@
+package peerfilter
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHysteresis(t *testing.T) {
+	peers := make(map[string]peerWithBytes)
+	for i, name := range []string{"a", "b", "c", "d"} {
+		peers[name] = parsedPeers(t, testPeer(i, name, 1, 1))[0]
+	}
+	ranking := func(names ...string) []peerWithBytes {
+		ranked := make([]peerWithBytes, 0, len(names))
+		for _, name := range names {
+			ranked = append(ranked, peers[name])
+		}
+		return ranked
+	}
+
+	h := &Hysteresis{Margin: 1, Intervals: 2}
+	for i, run := range []struct {
+		ranked []string
+		want   []string
+	}{
+		{[]string{"a", "b", "c", "d"}, []string{"a", "b"}},
+		// b slips just below the top 2 but stays within the margin.
+		{[]string{"a", "c", "b", "d"}, []string{"a", "b"}},
+		// b falls beyond the margin, but only for one run so far.
+		{[]string{"a", "c", "d", "b"}, []string{"a", "b"}},
+		// The second run in a row beyond the margin drops it.
+		{[]string{"a", "c", "d", "b"}, []string{"a", "c"}},
+		// c is kept once d overtakes it within the margin.
+		{[]string{"a", "d", "c", "b"}, []string{"a", "c"}},
+	} {
+		if got := rankedMonikers(h.apply(ranking(run.ranked...), 2)); !slices.Equal(got, run.want) {
+			t.Errorf("run %d ranked %v: selected %v, want %v", i+1, run.ranked, got, run.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package peerfilter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RateKernel weights a rate sample for RankWeightedRate by its age in
+// runs, 0 for the latest, out of n samples in the history.
+type RateKernel func(age, n int) float64
+
+// RateKernels lists the named kernels accepted by ParseRateKernel.
+var RateKernels = map[string]RateKernel{
+	// uniform weights every sample alike, a plain moving average.
+	"uniform": func(age, n int) float64 { return 1 },
+	// linear weights the latest sample n and the oldest 1.
+	"linear": func(age, n int) float64 { return float64(n - age) },
+	// exponential halves the weight with each run of age.
+	"exponential": func(age, n int) float64 { return math.Pow(0.5, float64(age)) },
+}
+
+// ParseRateKernel returns the kernel named s, or a kernel of explicit
+// comma-separated weights, latest sample first, such as "4,2,1". Samples
+// older than the listed weights get a weight of 0.
+func ParseRateKernel(s string) (RateKernel, error) {
+	if k, ok := RateKernels[s]; ok {
+		return k, nil
+	}
+	var weights []float64
+	for _, f := range strings.Split(s, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unknown rate kernel %q, want uniform, linear, exponential or comma-separated weights", s)
+		}
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight %q in rate kernel: must be a finite, non-negative number", f)
+		}
+		weights = append(weights, w)
+	}
+	return func(age, n int) float64 {
+		if age < len(weights) {
+			return weights[age]
+		}
+		return 0
+	}, nil
+}
+
+// weightedRate averages rates, oldest first, with the weights kernel
+// gives each sample. A nil kernel is uniform. It returns 0 when no sample
+// has weight.
+func weightedRate(rates []int64, kernel RateKernel) float64 {
+	if kernel == nil {
+		kernel = RateKernels["uniform"]
+	}
+	var sum, total float64
+	for i, r := range rates {
+		w := kernel(len(rates)-1-i, len(rates))
+		sum += w * float64(r)
+		total += w
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
@@ -0,0 +1,64 @@
+package peerfilter
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestRateKernelRanking(t *testing.T) {
+	fading, rising := []int64{1000, 1000, 1000, 100}, []int64{100, 100, 200, 900}
+	rank := func(kernel string) []string {
+		k, err := ParseRateKernel(kernel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &Stability{Window: len(fading), Kernel: k}
+		var peers []peerWithBytes
+		for i := range fading {
+			peers = parsedPeers(t, testPeer(1, "fading", 0, 0), testPeer(2, "rising", 0, 0))
+			peers[0].curRate, peers[1].curRate = fading[i], rising[i]
+			s.apply(peers)
+		}
+		if err := sortPeers(peers, RankWeightedRate, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+		return rankedMonikers(peers)
+	}
+
+	// Over the whole window the fading peer moved more, but it has
+	// slowed down lately.
+	if got, want := rank("uniform"), []string{"fading", "rising"}; !slices.Equal(got, want) {
+		t.Errorf("uniform kernel ranked %v, want %v", got, want)
+	}
+	for _, kernel := range []string{"exponential", "4,2,1"} {
+		if got, want := rank(kernel), []string{"rising", "fading"}; !slices.Equal(got, want) {
+			t.Errorf("%s kernel ranked %v, want %v", kernel, got, want)
+		}
+	}
+}
+
+func TestWeightedRate(t *testing.T) {
+	rates := []int64{100, 200, 300}
+	for kernel, want := range map[string]float64{
+		"uniform":     200,
+		"linear":      (100 + 2*200 + 3*300) / 6.0,
+		"exponential": (0.25*100 + 0.5*200 + 300) / 1.75,
+		"1":           300,
+		"0,0,1":       100,
+		"0":           0,
+	} {
+		k, err := ParseRateKernel(kernel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := weightedRate(rates, k); math.Abs(got-want) > 1e-9 {
+			t.Errorf("weightedRate with kernel %q = %g, want %g", kernel, got, want)
+		}
+	}
+	for _, bad := range []string{"gaussian", "1,-1", "1,NaN"} {
+		if _, err := ParseRateKernel(bad); err == nil {
+			t.Errorf("ParseRateKernel(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package peerfilter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SinceLastRun limits the output to peers that were not selected in the
+// previous run, so incremental dialing does not dial existing peers again.
+// Once a run's output is written, Save records its selection as JSON in
+// the state file at Path, which makes it survive restarts. The first run,
+// without a state file, outputs every selected peer.
+type SinceLastRun struct {
+	Path string `json:"path"`
+
+	seen  []string       // selected node IDs the previous run already output
+	fresh map[int]string // rank to node ID of the new peers, see Save
+}
+
+// runState is the content of a SinceLastRun state file.
+type runState struct {
+	SavedAt  time.Time `json:"saved_at"`
+	Selected []string  `json:"selected"`
+}
+
+// apply returns the peers of selected that the previous run did not
+// select and remembers the selection for Save.
+func (s *SinceLastRun) apply(selected []peerWithBytes) ([]peerWithBytes, error) {
+	prev, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.seen = nil
+	s.fresh = make(map[int]string)
+	var fresh []peerWithBytes
+	for _, p := range selected {
+		id := p.peer.NodeInfo.DefaultNodeID
+		if prev[id] {
+			s.seen = append(s.seen, id)
+			continue
+		}
+		fresh = append(fresh, p)
+		s.fresh[p.rank] = id
+	}
+	log.Infof("%d of %d selected peers are new since the last run", len(fresh), len(selected))
+	return fresh, nil
+}
+
+// Save records the selection of the run that produced res in the state
+// file. Call it once the output of res has been written: new peers that
+// res no longer holds, e.g. because Format trimmed them, are left out so
+// the next run outputs them again.
+func (s *SinceLastRun) Save(res *Result) error {
+	state := runState{SavedAt: time.Now().UTC(), Selected: append([]string{}, s.seen...)}
+	for _, p := range res.selected {
+		if id, ok := s.fresh[p.rank]; ok {
+			state.Selected = append(state.Selected, id)
+		}
+	}
+	return s.save(state)
+}
+
+// load reads the node IDs selected by the previous run. It returns nil
+// if there is no state file yet.
+func (s *SinceLastRun) load() (map[string]bool, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Infof("No state file at %s yet; treating every selected peer as new", s.Path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+	var state runState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %w", s.Path, err)
+	}
+	ids := make(map[string]bool, len(state.Selected))
+	for _, id := range state.Selected {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// save writes state to the state file.
+func (s *SinceLastRun) save(state runState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.Path, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path through a temporary file in the
+// same directory, so an interrupted run does not leave a truncated file
+// behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,40 @@
+package peerfilter
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSinceLastRun(t *testing.T) {
+	since := &SinceLastRun{Path: filepath.Join(t.TempDir(), "state.json")}
+	run := func(save bool, peers ...Peer) []string {
+		t.Helper()
+		res, err := SelectTopPeers(context.Background(), Options{FromFiles: []string{writeNetInfo(t, peers...)}, All: true, SinceLastRun: since})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if save {
+			if err := since.Save(res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return monikers(res.Peers)
+	}
+	a, b, c := testPeer(1, "a", 30, 30), testPeer(2, "b", 20, 20), testPeer(3, "c", 10, 10)
+
+	if got := run(true, a, b); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("first run output %v, want every peer", got)
+	}
+	if got := run(false, a, b, c); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("second run output %v, want only the new peer c", got)
+	}
+	// The second run was never saved, so c is still new.
+	if got := run(true, a, b, c); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("run after an unsaved one output %v, want c again", got)
+	}
+	if got := run(true, a, b, c); len(got) != 0 {
+		t.Errorf("run with no new peers output %v, want none", got)
+	}
+}
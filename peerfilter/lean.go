@@ -0,0 +1,47 @@
+package peerfilter
+
+import "encoding/json"
+
+// leanNetInfoResult is a reduced view of the net_info response that only
+// decodes what is needed to rank peers by bytes and build their addresses.
+// Channels, rates and the rest of the node info are skipped.
+type leanNetInfoResult struct {
+	Result struct {
+		Listeners []string   `json:"listeners"`
+		Peers     []leanPeer `json:"peers"`
+	} `json:"result"`
+	ID any `json:"id"`
+}
+
+type leanPeer struct {
+	NodeInfo struct {
+		DefaultNodeID string `json:"id"`
+		ListenAddr    string `json:"listen_addr"`
+	} `json:"node_info"`
+	ConnectionStatus struct {
+		SendMonitor struct{ Bytes string }
+		RecvMonitor struct{ Bytes string }
+	} `json:"connection_status"`
+	RemoteIP string `json:"remote_ip"`
+}
+
+// decodeNetInfoLean decodes the listeners, peers and JSON-RPC id of a
+// net_info response using the reduced leanNetInfoResult. Fields it skips
+// are left zero in the returned peers.
+func decodeNetInfoLean(body []byte) (ResultNetInfo, any, error) {
+	var res leanNetInfoResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return ResultNetInfo{}, nil, err
+	}
+	peers := make([]Peer, 0, len(res.Result.Peers))
+	for _, lp := range res.Result.Peers {
+		var p Peer
+		p.NodeInfo.DefaultNodeID = lp.NodeInfo.DefaultNodeID
+		p.NodeInfo.ListenAddr = lp.NodeInfo.ListenAddr
+		p.ConnectionStatus.SendMonitor.Bytes = lp.ConnectionStatus.SendMonitor.Bytes
+		p.ConnectionStatus.RecvMonitor.Bytes = lp.ConnectionStatus.RecvMonitor.Bytes
+		p.RemoteIP = lp.RemoteIP
+		peers = append(peers, p)
+	}
+	return ResultNetInfo{Listeners: res.Result.Listeners, Peers: peers}, res.ID, nil
+}
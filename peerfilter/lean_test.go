@@ -0,0 +1,66 @@
+package peerfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+// largeNetInfo returns a net_info response of n peers, each with a full
+// set of channels, as a busy node reports it.
+func largeNetInfo(tb testing.TB, n int) []byte {
+	tb.Helper()
+	peers := make([]Peer, 0, n)
+	for i := range n {
+		p := testPeer(i, fmt.Sprintf("peer-%d", i), int64(i)*1000, int64(i)*2000)
+		p.NodeInfo.DefaultNodeID = fmt.Sprintf("%040x", i)
+		p.NodeInfo.Channels = "40202122233038606100"
+		for _, id := range []byte{0x21, 0x22, 0x23, 0x30, 0x38, 0x60, 0x61, 0x00} {
+			p.ConnectionStatus.Channels = append(p.ConnectionStatus.Channels, ChannelStatus{
+				ID: id, SendQueueCapacity: "1000", SendQueueSize: "0", Priority: "5", RecentlySent: "1234",
+			})
+		}
+		peers = append(peers, p)
+	}
+	return netInfoBody(tb, peers...)
+}
+
+func TestDecodeNetInfoLean(t *testing.T) {
+	body := largeNetInfo(t, 3)
+	full, _, err := decodeNetInfo(body, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lean, _, err := decodeNetInfo(body, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lean.Peers) != len(full.Peers) {
+		t.Fatalf("lean decoded %d peers, full %d", len(lean.Peers), len(full.Peers))
+	}
+	for i, l := range lean.Peers {
+		f := full.Peers[i]
+		if l.NodeInfo.DefaultNodeID != f.NodeInfo.DefaultNodeID || l.NodeInfo.ListenAddr != f.NodeInfo.ListenAddr ||
+			l.RemoteIP != f.RemoteIP ||
+			l.ConnectionStatus.SendMonitor.Bytes != f.ConnectionStatus.SendMonitor.Bytes ||
+			l.ConnectionStatus.RecvMonitor.Bytes != f.ConnectionStatus.RecvMonitor.Bytes {
+			t.Errorf("peer %d: lean %+v differs from full in the fields it decodes", i, l)
+		}
+		if l.NodeInfo.Moniker != "" || l.ConnectionStatus.Channels != nil {
+			t.Errorf("peer %d: lean decoded fields it should skip", i)
+		}
+	}
+}
+
+func benchmarkDecodeNetInfo(b *testing.B, lean bool) {
+	body := largeNetInfo(b, 1000)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for range b.N {
+		if _, _, err := decodeNetInfo(body, lean); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeNetInfoLean(b *testing.B) { benchmarkDecodeNetInfo(b, true) }
+func BenchmarkDecodeNetInfoFull(b *testing.B) { benchmarkDecodeNetInfo(b, false) }
@@ -0,0 +1,78 @@
+package peerfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatMarkdown renders peers as a Markdown table in rank order, followed
+// by a summary line, for pasting into issues or wikis. With
+// opts.ASNDatabase the table has an extra AS column, and with
+// opts.Sparklines a column of recent rates.
+func formatMarkdown(peers []peerWithBytes, opts Options) string {
+	withASN := opts.ASNDatabase != ""
+	var b strings.Builder
+	b.WriteString("| Rank | Moniker | IP |")
+	if withASN {
+		b.WriteString(" AS |")
+	}
+	b.WriteString(" Bytes | Network |")
+	if opts.Sparklines {
+		b.WriteString(" Recent rate |")
+	}
+	b.WriteString("\n| ---: | --- | --- |")
+	if withASN {
+		b.WriteString(" --- |")
+	}
+	b.WriteString(" ---: | --- |")
+	if opts.Sparklines {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	var total int64
+	for i, p := range peers {
+		total += p.totalBytes
+		fmt.Fprintf(&b, "| %d | %s | %s |", i+1,
+			markdownCell(truncateMoniker(p.peer.NodeInfo.Moniker, opts.MaxMonikerLen)),
+			markdownCell(p.peer.RemoteIP),
+		)
+		if withASN {
+			as := ""
+			if p.asn != 0 {
+				as = fmt.Sprintf("AS%d %s", p.asn, p.asOrg)
+			}
+			fmt.Fprintf(&b, " %s |", markdownCell(strings.TrimSpace(as)))
+		}
+		fmt.Fprintf(&b, " %s | %s |", humanizeBytes(p.totalBytes), markdownCell(p.peer.NodeInfo.Network))
+		if opts.Sparklines {
+			fmt.Fprintf(&b, " `%s` |", sparkline(p.rates))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n%d peers by %s, %s in total.\n", len(peers), opts.SortBy, humanizeBytes(total))
+	return b.String()
+}
+
+// markdownCell escapes s for use inside a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\r", " ", "\n", " ").Replace(s)
+	if s == "" {
+		return " "
+	}
+	return s
+}
+
+// humanizeBytes formats n using binary units, e.g. 1536 as "1.5 KiB".
+func humanizeBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n) / unit
+	exp := 0
+	for (v >= unit || v <= -unit) && exp < len("KMGTPE")-1 {
+		v /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, "KMGTPE"[exp])
+}
@@ -0,0 +1,66 @@
+package peerfilter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// markdownCells returns the cells of a Markdown table row, splitting on
+// unescaped pipes.
+func markdownCells(t *testing.T, row string) []string {
+	t.Helper()
+	if !strings.HasPrefix(row, "| ") || !strings.HasSuffix(row, " |") {
+		t.Fatalf("table row %q does not start and end with a pipe", row)
+	}
+	var cells []string
+	var cell strings.Builder
+	inner := row[1 : len(row)-1]
+	for i := 0; i < len(inner); i++ {
+		switch {
+		case inner[i] == '\\' && i+1 < len(inner):
+			cell.WriteByte(inner[i+1])
+			i++
+		case inner[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(inner[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func TestFormatMarkdown(t *testing.T) {
+	res := testResult(t, testPeer(1, "pipe|moniker", 1024, 512), testPeer(2, "b", 10, 10))
+	out, err := Format(res, Options{OutputFormat: "md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("markdown output has %d lines, want a header, a delimiter, 2 rows, a blank line and a summary:\n%s", len(lines), out)
+	}
+	header := markdownCells(t, lines[0])
+	if want := []string{"Rank", "Moniker", "IP", "Bytes", "Network"}; !slices.Equal(header, want) {
+		t.Errorf("header cells = %q, want %q", header, want)
+	}
+	delimiter := regexp.MustCompile(`^:?-{3,}:?$`)
+	for _, cell := range markdownCells(t, lines[1]) {
+		if !delimiter.MatchString(cell) {
+			t.Errorf("delimiter cell %q is not a Markdown alignment marker", cell)
+		}
+	}
+	for _, row := range lines[1:4] {
+		if cells := markdownCells(t, row); len(cells) != len(header) {
+			t.Errorf("row %q has %d cells, want %d", row, len(cells), len(header))
+		}
+	}
+	if got := markdownCells(t, lines[2]); got[1] != "pipe|moniker" || got[3] != "1.5 KiB" {
+		t.Errorf("first row = %q, want the moniker with its pipe escaped and 1.5 KiB", got)
+	}
+	if lines[4] != "" || lines[5] != "2 peers by bytes, 1.5 KiB in total." {
+		t.Errorf("summary = %q, want it after a blank line", lines[4:])
+	}
+}
@@ -0,0 +1,110 @@
+package peerfilter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Registry holds the collectors updated by RecordMetrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	peersGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_peers",
+		Help: "Number of peers reported by net_info.",
+	})
+	peersPassedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_peers_passed",
+		Help: "Number of peers that passed the filters.",
+	})
+	peersSelectedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_peers_selected",
+		Help: "Number of peers written to the output.",
+	})
+	bytesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_bytes",
+		Help: "Bytes sent and received across all peers.",
+	})
+	peerBytesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peer_filter_peer_bytes",
+		Help: "Bytes sent and received per peer.",
+	}, []string{"node_id", "moniker"})
+	peerVersionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peer_filter_peer_version_count",
+		Help: "Number of peers reported by net_info per software version and network.",
+	}, []string{"version", "network"})
+	responseBytesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_response_bytes",
+		Help: "Size of the net_info responses of the last run.",
+	})
+	bytesPerPeerGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_response_bytes_per_peer",
+		Help: "Average net_info response size per reported peer.",
+	})
+	lastRunGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_last_run_timestamp_seconds",
+		Help: "Unix time of the last completed run.",
+	})
+	runDurationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_filter_run_duration_seconds",
+		Help: "Time from the start of the last run's fetch to its last write.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		peersGauge,
+		peersPassedGauge,
+		peersSelectedGauge,
+		bytesGauge,
+		peerBytesGauge,
+		peerVersionsGauge,
+		responseBytesGauge,
+		bytesPerPeerGauge,
+		lastRunGauge,
+		runDurationGauge,
+	)
+}
+
+// RecordMetrics updates the collectors from one run. Per-peer series are
+// reset first so peers that disconnected do not linger. With topOnly,
+// per-peer series are only exported for the selected peers; aggregates,
+// including the version counts, always cover all peers. Labels honor
+// Options.Anonymize and Options.Redact.
+func RecordMetrics(res *Result, topOnly bool) {
+	peersGauge.Set(float64(res.Aggregates.TotalPeers))
+	peersPassedGauge.Set(float64(res.Aggregates.PassedPeers))
+	peersSelectedGauge.Set(float64(res.Aggregates.SelectedPeers))
+	bytesGauge.Set(float64(res.Aggregates.TotalBytes))
+	responseBytesGauge.Set(float64(res.Aggregates.ResponseBytes))
+	bytesPerPeerGauge.Set(res.Aggregates.BytesPerPeer)
+
+	perPeer := res.scrub(res.all)
+	if topOnly {
+		perPeer = res.selected
+	}
+	peerBytesGauge.Reset()
+	for _, p := range perPeer {
+		// Add, as redacted peers can share their labels.
+		peerBytesGauge.WithLabelValues(p.peer.NodeInfo.DefaultNodeID, p.peer.NodeInfo.Moniker).Add(float64(p.totalBytes))
+	}
+
+	peerVersionsGauge.Reset()
+	for _, p := range res.scrub(res.all) {
+		peerVersionsGauge.WithLabelValues(p.peer.NodeInfo.Version, p.peer.NodeInfo.Network).Inc()
+	}
+	lastRunGauge.Set(float64(time.Now().Unix()))
+}
+
+// RecordRunDuration sets how long the last run took, from fetching
+// net_info to writing its outputs.
+func RecordRunDuration(d time.Duration) {
+	runDurationGauge.Set(d.Seconds())
+}
+
+// WriteMetricsFile writes the metrics in Registry in the Prometheus text
+// format, e.g. for the node_exporter textfile collector. The file is
+// replaced atomically.
+func WriteMetricsFile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
@@ -0,0 +1,120 @@
+package peerfilter
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetricsFile(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "alpha", 10, 10), testPeer(2, "beta", 5, 5))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecordMetrics(res, false)
+	path := filepath.Join(t.TempDir(), "peer_filter.prom")
+	if err := WriteMetricsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for _, want := range []string{
+		"peer_filter_peers 2",
+		"peer_filter_peers_passed 2",
+		"peer_filter_peers_selected 1",
+		"peer_filter_bytes 30",
+		`peer_filter_peer_bytes{moniker="alpha",node_id="` + testID("1") + `"} 20`,
+		`peer_filter_peer_bytes{moniker="beta",node_id="` + testID("2") + `"} 10`,
+		`peer_filter_peer_version_count{network="testnet-1",version="0.38.12"} 2`,
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("metrics file has no line %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestRecordMetricsTopOnly(t *testing.T) {
+	var peers []Peer
+	for i := range 5 {
+		peers = append(peers, testPeer(i, strconv.Itoa(i), int64(10*(i+1)), 0))
+	}
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{serveNetInfo(t, peers...)}, TopPeers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecordMetrics(res, true)
+	if got := len(gaugeLabels(t, "peer_filter_peer_bytes")); got != 2 {
+		t.Errorf("%d per-peer series with top-only metrics, want 2", got)
+	}
+	RecordMetrics(res, false)
+	if got := len(gaugeLabels(t, "peer_filter_peer_bytes")); got != 5 {
+		t.Errorf("%d per-peer series without top-only metrics, want 5", got)
+	}
+}
+
+func TestPeerVersionCount(t *testing.T) {
+	// versionCounts scrapes the version gauge as version/network to count.
+	versionCounts := func() map[string]float64 {
+		families, err := Registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]float64)
+		for _, f := range families {
+			if f.GetName() != "peer_filter_peer_version_count" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				labels := make(map[string]string)
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				counts[labels["version"]+"/"+labels["network"]] = m.GetGauge().GetValue()
+			}
+		}
+		return counts
+	}
+	peer := func(n int, version, network string) Peer {
+		p := testPeer(n, strconv.Itoa(n), int64(10*n), 0)
+		p.NodeInfo.Version, p.NodeInfo.Network = version, network
+		return p
+	}
+
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{serveNetInfo(t,
+		peer(1, "0.38.12", "testnet-1"),
+		peer(2, "0.38.12", "testnet-1"),
+		peer(3, "0.37.4", "testnet-1"),
+		peer(4, "0.38.12", "othernet-2"),
+	)}, TopPeers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecordMetrics(res, true)
+	// The counts cover every peer, not only the selected one.
+	want := map[string]float64{"0.38.12/testnet-1": 2, "0.37.4/testnet-1": 1, "0.38.12/othernet-2": 1}
+	if got := versionCounts(); !maps.Equal(got, want) {
+		t.Errorf("version counts %v, want %v", got, want)
+	}
+
+	// After an upgrade the old version's series is gone.
+	res, err = SelectTopPeers(context.Background(), Options{Hosts: []string{serveNetInfo(t,
+		peer(1, "0.38.12", "testnet-1"),
+		peer(3, "0.38.12", "testnet-1"),
+	)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecordMetrics(res, false)
+	if got, want := versionCounts(), map[string]float64{"0.38.12/testnet-1": 2}; !maps.Equal(got, want) {
+		t.Errorf("version counts after the upgrade %v, want %v", got, want)
+	}
+}
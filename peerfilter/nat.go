@@ -0,0 +1,42 @@
+package peerfilter
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// splitRemoteIP separates the port some nodes append to remote_ip, e.g.
+// "1.2.3.4:26656". A bare IP is returned with an empty port.
+func splitRemoteIP(s string) (ip, port string) {
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		return host, port
+	}
+	return s, ""
+}
+
+// portMismatch reports whether p was dialed on a port other than the one
+// it advertises, which points at a port-mapping NAT. Only outbound
+// connections whose remote_ip carries a port can tell: an inbound peer's
+// remote port is the ephemeral one it dialed from.
+func portMismatch(p peerWithBytes) bool {
+	if !p.peer.IsOutbound || p.remotePort == "" {
+		return false
+	}
+	_, port, err := net.SplitHostPort(p.address)
+	return err == nil && port != p.remotePort
+}
+
+// checkPortMismatch warns about the peers portMismatch flags and returns
+// how many there are.
+func checkPortMismatch(peers []peerWithBytes) int {
+	mismatched := 0
+	for _, p := range peers {
+		if !portMismatch(p) {
+			continue
+		}
+		mismatched++
+		log.Warnf("Peer %s (%s) advertises %s but was reached on port %s; it may be behind a port-mapping NAT",
+			p.peer.NodeInfo.DefaultNodeID, p.peer.RemoteIP, p.address, p.remotePort)
+	}
+	return mismatched
+}
@@ -0,0 +1,40 @@
+package peerfilter
+
+import (
+	"github.com/sirupsen/logrus/hooks/test"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPortMismatch(t *testing.T) {
+	matched := testPeer(1, "matched", 10, 10)
+	matched.IsOutbound = true
+	matched.RemoteIP = "10.0.0.1:26656"
+	mapped := testPeer(2, "mapped", 10, 10)
+	mapped.IsOutbound = true
+	mapped.RemoteIP = "10.0.0.2:31000"
+	// An inbound peer's remote port is its ephemeral source port.
+	inbound := testPeer(3, "inbound", 10, 10)
+	inbound.RemoteIP = "10.0.0.3:53211"
+	bare := testPeer(4, "bare", 10, 10)
+	bare.IsOutbound = true
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	peers := parsedPeers(t, matched, mapped, inbound, bare)
+	if got := checkPortMismatch(peers); got != 1 {
+		t.Errorf("checkPortMismatch flagged %d peers, want 1", got)
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "reached on port 31000") {
+		t.Errorf("last log entry %v, want a warning about port 31000", e)
+	}
+	if peers[1].peer.RemoteIP != "10.0.0.2" {
+		t.Errorf("remote IP %q kept its port", peers[1].peer.RemoteIP)
+	}
+
+	got := keptMonikers(t, Options{SkipPortMismatch: true}, matched, mapped, inbound, bare)
+	if want := []string{"matched", "inbound", "bare"}; !slices.Equal(got, want) {
+		t.Errorf("-skip-port-mismatch kept %v, want %v", got, want)
+	}
+}
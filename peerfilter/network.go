@@ -0,0 +1,81 @@
+package peerfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// statusResult is the part of a /status response fetchNetwork reads.
+type statusResult struct {
+	Result struct {
+		NodeInfo struct {
+			Network string `json:"network"`
+		} `json:"node_info"`
+	} `json:"result"`
+}
+
+// fetchNetwork returns the chain ID host reports in /status, requested in
+// the same RPC mode as net_info.
+func fetchNetwork(ctx context.Context, host string, opts Options) (string, error) {
+	var req *http.Request
+	var err error
+	if opts.RPCMode == "jsonrpc" {
+		body, _ := json.Marshal(jsonRPCRequest{JSONRPC: "2.0", ID: rpcIDValue(opts.RPCID), Method: "status", Params: map[string]any{}})
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, addPrefix(host), bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, addPrefix(host+"/status"), nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error building status request for %s: %w", host, err)
+	}
+	resp, err := newRPCClient(opts).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching status from %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status from %s returned %s", host, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading status from %s: %w", host, err)
+	}
+	var status statusResult
+	if err := json.Unmarshal(body, &status); err != nil {
+		return "", fmt.Errorf("error unmarshaling status from %s: %w", host, err)
+	}
+	if status.Result.NodeInfo.Network == "" {
+		return "", fmt.Errorf("status from %s has no network", host)
+	}
+	return status.Result.NodeInfo.Network, nil
+}
+
+// detectNetwork returns the chain ID of hosts from their /status. Hosts
+// that cannot be asked are skipped with a warning; hosts on different
+// chains are an error. It returns "" if no host answered.
+func detectNetwork(ctx context.Context, hosts []string, opts Options) (string, error) {
+	var network string
+	var on []string
+	for _, host := range hosts {
+		n, err := fetchNetwork(ctx, host, opts)
+		if err != nil {
+			log.Warnf("Not detecting the network from %s: %v", host, err)
+			continue
+		}
+		if network != "" && n != network {
+			return "", fmt.Errorf("hosts are on different networks (%s on %s, %s on %s); set the network explicitly", strings.Join(on, ","), network, host, n)
+		}
+		network = n
+		on = append(on, host)
+	}
+	return network, nil
+}
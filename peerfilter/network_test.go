@@ -0,0 +1,72 @@
+package peerfilter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveNetInfoStatus starts an RPC stub that answers /net_info with peers
+// and /status with chain ID network, and returns its URL.
+func serveNetInfoStatus(t *testing.T, network string, peers ...Peer) string {
+	t.Helper()
+	body := netInfoBody(t, peers...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/net_info":
+			w.Write(body)
+		case "/status":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"result":{"node_info":{"network":%q}}}`, network)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestDetectNetwork(t *testing.T) {
+	other := testPeer(2, "other", 100, 100)
+	other.NodeInfo.Network = "othernet-2"
+	peers := []Peer{testPeer(1, "local", 10, 10), other}
+	host := serveNetInfoStatus(t, "testnet-1", peers...)
+
+	for _, tc := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{DetectNetwork: true}, "local"},
+		// An explicit network wins over the detected one.
+		{Options{DetectNetwork: true, Network: "othernet-2"}, "other"},
+		{Options{}, "other,local"},
+	} {
+		tc.opts.Hosts = []string{host}
+		res, err := SelectTopPeers(context.Background(), tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(monikers(res.Peers), ","); got != tc.want {
+			t.Errorf("network %q, detect %v: selected %s, want %s", tc.opts.Network, tc.opts.DetectNetwork, got, tc.want)
+		}
+	}
+
+	// A host without /status is skipped.
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host, serveNetInfo(t)}, DetectNetwork: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "local" {
+		t.Errorf("with a host lacking /status selected %s, want local", got)
+	}
+
+	_, err = SelectTopPeers(context.Background(), Options{
+		Hosts:         []string{host, serveNetInfoStatus(t, "othernet-2", other)},
+		DetectNetwork: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "different networks") {
+		t.Errorf("hosts on two chains: err = %v, want a different networks error", err)
+	}
+}
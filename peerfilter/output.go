@@ -0,0 +1,367 @@
+package peerfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerRecord is the flattened, JSON-friendly view of a selected peer.
+type PeerRecord struct {
+	Rank            int             `json:"rank"` // position by Options.SortBy among the peers that passed the filters
+	NodeID          string          `json:"node_id"`
+	Address         string          `json:"address"`
+	RemoteIP        string          `json:"remote_ip"`
+	Moniker         string          `json:"moniker"`
+	Network         string          `json:"network"`
+	Version         string          `json:"version"`
+	ProtocolVersion ProtocolVersion `json:"protocol_version"`
+	IsOutbound      bool            `json:"is_outbound"`
+	TotalBytes      int64           `json:"total_bytes"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	SourceHosts     []string        `json:"source_hosts"` // hosts that reported the peer
+
+	// ASN and ASOrg are only set with Options.ASNDatabase.
+	ASN   uint   `json:"asn,omitempty"`
+	ASOrg string `json:"as_org,omitempty"`
+
+	// ConnectionStatus is only set with Options.IncludeConnectionStatus.
+	ConnectionStatus *ConnectionStatus `json:"connection_status,omitempty"`
+}
+
+// peerAddress returns the dialable host:port of a peer, replacing an
+// unspecified 0.0.0.0 listen address with the peer's remote IP and
+// appending defaultPort when the listen address has no port.
+func peerAddress(p Peer, defaultPort int) string {
+	listenAddr := strings.Replace(p.NodeInfo.ListenAddr, "tcp://", "", -1)
+	if strings.Contains(listenAddr, "0.0.0.0") {
+		listenAddr = strings.Replace(listenAddr, "0.0.0.0", p.RemoteIP, -1)
+	}
+	return withDefaultPort(listenAddr, defaultPort)
+}
+
+// rpcAddress returns the host:port of a peer's advertised RPC listener,
+// replacing an unspecified or loopback host with the peer's remote IP.
+func rpcAddress(p Peer) (string, error) {
+	addr := p.NodeInfo.Other.RPCAddress
+	if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid rpc address %q: %w", p.NodeInfo.Other.RPCAddress, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && (ip.IsUnspecified() || ip.IsLoopback())) {
+		host = p.RemoteIP
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// withDefaultPort appends port to addr if addr is a bare host or IP.
+func withDefaultPort(addr string, port int) string {
+	if addr == "" {
+		return addr
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	portStr := strconv.Itoa(port)
+	switch {
+	case strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]"):
+		return addr + ":" + portStr
+	case net.ParseIP(addr) != nil, !strings.Contains(addr, ":"):
+		return net.JoinHostPort(addr, portStr)
+	}
+	// Ambiguous, e.g. an unbracketed IPv6 address followed by a port.
+	return addr
+}
+
+// Format renders the selected peers of res in the output format set in opts.
+// With opts.TimestampHeader, formats that allow comments start with a
+// "# generated at" line and the listeners of each host. The output is
+// then encoded with opts.OutputEncoding, and with opts.MaxOutputBytes the
+// lowest-ranked peers are left out until the encoded output fits. They are
+// removed from res as well, so every other use of res agrees with the
+// output. The full-json format renders all of res; see FullDump.
+func Format(res *Result, opts Options) (string, error) {
+	opts = opts.withDefaults()
+	if opts.OutputFormat == "full-json" {
+		out, err := formatFullJSON(res, opts)
+		if err != nil {
+			return "", err
+		}
+		return encodeOutput(out, opts.OutputEncoding)
+	}
+	trimmed := *res
+	for {
+		out, err := formatOutput(trimmed.selected, opts)
+		if err != nil {
+			return "", err
+		}
+		if opts.TimestampHeader && SupportsComments(opts.OutputFormat) {
+			out = formatHeader(res.Metadata) + out
+		}
+		if out, err = encodeOutput(out, opts.OutputEncoding); err != nil {
+			return "", err
+		}
+		if opts.MaxOutputBytes <= 0 || len(out) <= opts.MaxOutputBytes {
+			if dropped := len(res.selected) - len(trimmed.selected); dropped > 0 {
+				log.Warnf("Dropped the %d lowest-ranked of %d peers to fit the output in %d bytes", dropped, len(res.selected), opts.MaxOutputBytes)
+				*res = trimmed
+			}
+			return out, nil
+		}
+		if len(trimmed.selected) == 0 {
+			return "", fmt.Errorf("output does not fit in %d bytes even without peers", opts.MaxOutputBytes)
+		}
+		trimmed.dropLowestRanked()
+	}
+}
+
+// dropLowestRanked removes the selected peer with the highest rank number
+// from r, keeping the order of the rest. It does not modify the slices r
+// shares with other Results.
+func (r *Result) dropLowestRanked() {
+	lowest := 0
+	for i, p := range r.selected {
+		if p.rank > r.selected[lowest].rank {
+			lowest = i
+		}
+	}
+	r.selected = slices.Delete(slices.Clone(r.selected), lowest, lowest+1)
+	r.Peers = slices.Delete(slices.Clone(r.Peers), lowest, lowest+1)
+	r.Aggregates.SelectedPeers = len(r.selected)
+}
+
+// formatHeader renders the comment lines written with
+// Options.TimestampHeader: the generation time and the listeners of each
+// host.
+func formatHeader(meta Metadata) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# generated at %s\n", meta.FetchedAt.UTC().Format(time.RFC3339))
+	for _, host := range meta.Hosts {
+		if listeners, ok := meta.Listeners[host]; ok {
+			fmt.Fprintf(&b, "# listeners of %s: %s\n", host, strings.Join(listeners, ", "))
+		}
+	}
+	return b.String()
+}
+
+// SupportsComments reports whether an output format allows "#" comment
+// lines. The peerstring format does not: it is pasted as-is into
+// persistent_peers, which is a single line.
+func SupportsComments(format string) bool {
+	switch format {
+	case "commented", "systemd-env", "tfvars":
+		return true
+	}
+	return false
+}
+
+// formatOutput renders peers in the output format set in opts.
+func formatOutput(peers []peerWithBytes, opts Options) (string, error) {
+	switch opts.OutputFormat {
+	case "peerstring":
+		return peerString(peers, opts)
+	case "json":
+		return formatJSON(peers, opts)
+	case "commented":
+		return formatCommented(peers, opts.SchemePrefix), nil
+	case "consul":
+		return formatConsul(peers, opts.ConsulService)
+	case "csv":
+		return formatCSV(peers, opts)
+	case "ids":
+		return formatIDs(peers)
+	case "md":
+		return formatMarkdown(peers, opts), nil
+	case "systemd-env":
+		peers, err := peerString(peers, opts)
+		return fmt.Sprintf("%s=%s\n", opts.EnvKey, peers), err
+	case "tfvars":
+		peers, err := peerString(peers, opts)
+		return fmt.Sprintf("%s = %s\n", opts.TFVarsKey, hclString(peers)), err
+	default:
+		return "", fmt.Errorf("unknown output format %q", opts.OutputFormat)
+	}
+}
+
+// hclString quotes s as an HCL string literal, escaping template
+// sequences so Terraform takes it verbatim.
+func hclString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "${", "$${", "%{", "%%{").Replace(s) + `"`
+}
+
+// peerEntry returns the id@host:port form of a peer, preceded by scheme
+// (e.g. "tcp://") if set.
+func peerEntry(p peerWithBytes, scheme string) string {
+	return fmt.Sprintf("%s%s@%s", scheme, p.peer.NodeInfo.DefaultNodeID, p.address)
+}
+
+// peerString renders peers as a peer string, with buildPeerString if
+// opts.CompactPeerString is set.
+func peerString(peers []peerWithBytes, opts Options) (string, error) {
+	if opts.CompactPeerString {
+		return buildPeerString(peers, BuildOpts{Scheme: opts.SchemePrefix, MaxEntries: opts.MaxEntries})
+	}
+	return formatPeerString(peers, opts.SchemePrefix), nil
+}
+
+// formatPeerString renders peers as a comma-separated id@host:port list,
+// suitable for CometBFT's persistent_peers setting.
+func formatPeerString(peers []peerWithBytes, scheme string) string {
+	entries := make([]string, 0, len(peers))
+	for _, p := range peers {
+		entries = append(entries, peerEntry(p, scheme))
+	}
+	return strings.Join(entries, ",")
+}
+
+func newPeerRecord(p peerWithBytes) PeerRecord {
+	return PeerRecord{
+		Rank:            p.rank,
+		NodeID:          p.peer.NodeInfo.DefaultNodeID,
+		Address:         p.address,
+		RemoteIP:        p.peer.RemoteIP,
+		Moniker:         p.peer.NodeInfo.Moniker,
+		Network:         p.peer.NodeInfo.Network,
+		Version:         p.peer.NodeInfo.Version,
+		ProtocolVersion: p.peer.NodeInfo.ProtocolVersion,
+		IsOutbound:      p.peer.IsOutbound,
+		TotalBytes:      p.totalBytes,
+		DurationSeconds: p.duration.Seconds(),
+		SourceHosts:     p.sources,
+		ASN:             p.asn,
+		ASOrg:           p.asOrg,
+	}
+}
+
+func formatJSON(peers []peerWithBytes, opts Options) (string, error) {
+	records := make([]PeerRecord, 0, len(peers))
+	for _, p := range peers {
+		r := newPeerRecord(p)
+		r.Moniker = truncateMoniker(r.Moniker, opts.MaxMonikerLen)
+		if opts.IncludeConnectionStatus {
+			cs := p.peer.ConnectionStatus
+			r.ConnectionStatus = &cs
+		}
+		records = append(records, r)
+	}
+	out, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+// formatIDs renders the node IDs of peers as a JSON array in rank order.
+func formatIDs(peers []peerWithBytes) (string, error) {
+	ids := make([]string, 0, len(peers))
+	for _, p := range peers {
+		ids = append(ids, p.peer.NodeInfo.DefaultNodeID)
+	}
+	out, err := json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+// formatCommented renders one peer per line, grouped by network. Each group
+// is preceded by a "# <network>" comment line. Groups appear in the order
+// their best-ranked peer does.
+func formatCommented(peers []peerWithBytes, scheme string) string {
+	var networks []string
+	groups := make(map[string][]string)
+	for _, p := range peers {
+		network := p.peer.NodeInfo.Network
+		if _, ok := groups[network]; !ok {
+			networks = append(networks, network)
+		}
+		groups[network] = append(groups[network], peerEntry(p, scheme))
+	}
+
+	var b strings.Builder
+	for i, network := range networks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		label := network
+		if label == "" {
+			label = "unknown network"
+		}
+		fmt.Fprintf(&b, "# %s\n", label)
+		for _, entry := range groups[network] {
+			b.WriteString(entry + "\n")
+		}
+	}
+	return b.String()
+}
+
+// consulService is a Consul agent service definition, as accepted by
+// PUT /v1/agent/service/register.
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// formatConsul renders one Consul service registration per line, pointing at
+// each peer's RPC endpoint. Peers without a usable RPC address are skipped.
+func formatConsul(peers []peerWithBytes, service string) (string, error) {
+	var b strings.Builder
+	for _, p := range peers {
+		addr, err := rpcAddress(p.peer)
+		if err != nil {
+			log.Warnf("Skipping peer %s in consul output: %v", p.peer.NodeInfo.DefaultNodeID, err)
+			continue
+		}
+		host, portStr, _ := net.SplitHostPort(addr)
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Warnf("Skipping peer %s in consul output: invalid rpc port %q", p.peer.NodeInfo.DefaultNodeID, portStr)
+			continue
+		}
+
+		var tags []string
+		if p.peer.NodeInfo.Network != "" {
+			tags = append(tags, p.peer.NodeInfo.Network)
+		}
+		out, err := json.Marshal(consulService{
+			ID:      fmt.Sprintf("%s-%s", service, p.peer.NodeInfo.DefaultNodeID),
+			Name:    service,
+			Address: host,
+			Port:    port,
+			Tags:    tags,
+			Meta: map[string]string{
+				"node_id": p.peer.NodeInfo.DefaultNodeID,
+				"moniker": p.peer.NodeInfo.Moniker,
+				"p2p":     p.address,
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		b.Write(out)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// truncateMoniker shortens a moniker to at most max characters, ending it
+// with an ellipsis when cut. A max of zero or less leaves it unchanged.
+func truncateMoniker(moniker string, max int) string {
+	runes := []rune(moniker)
+	if max <= 0 || len(runes) <= max {
+		return moniker
+	}
+	return string(runes[:max-1]) + "…"
+}
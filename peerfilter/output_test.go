@@ -0,0 +1,323 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testResult returns a Result selecting peers in the given order, ranked
+// 1 to n, as SelectTopPeers would.
+func testResult(t *testing.T, peers ...Peer) *Result {
+	t.Helper()
+	res := &Result{selected: parsedPeers(t, peers...)}
+	for i := range res.selected {
+		res.selected[i].rank = i + 1
+		res.Peers = append(res.Peers, newPeerRecord(res.selected[i]))
+	}
+	res.all = res.selected
+	res.passed = res.selected
+	res.Aggregates.SelectedPeers = len(res.selected)
+	return res
+}
+
+func TestFormatBase64(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 10, 10), testPeer(2, "b", 5, 5))
+	raw, err := Format(res, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Format(res, Options{OutputEncoding: "base64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeOutput(encoded, "base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != raw {
+		t.Errorf("decoded base64 output = %q, want %q", decoded, raw)
+	}
+}
+
+func TestFormatMaxOutputBytesEncoded(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 30, 30), testPeer(2, "b", 20, 20), testPeer(3, "c", 10, 10))
+	const limit = 110
+	out, err := Format(res, Options{OutputEncoding: "base64", MaxOutputBytes: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > limit {
+		t.Errorf("encoded output is %d bytes, want at most %d", len(out), limit)
+	}
+	decoded, err := DecodeOutput(out, "base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testID("1") + "@10.0.0.1:26656"; decoded != want {
+		t.Errorf("decoded output = %q, want only the top peer %q", decoded, want)
+	}
+}
+
+func TestFormatTrimsResult(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 30, 30), testPeer(2, "b", 20, 20), testPeer(3, "c", 10, 10))
+	entry := len(testID("1") + "@10.0.0.1:26656")
+	out, err := Format(res, Options{MaxOutputBytes: 2*entry + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(out, "@"); got != 2 {
+		t.Fatalf("output %q has %d entries, want 2", out, got)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "a,b" {
+		t.Errorf("Result.Peers after trimming = %s, want a,b", got)
+	}
+	if len(res.selected) != 2 || res.Aggregates.SelectedPeers != 2 {
+		t.Errorf("Result holds %d selected peers and counts %d, want 2", len(res.selected), res.Aggregates.SelectedPeers)
+	}
+
+	if _, err := Format(res, Options{OutputFormat: "commented", MaxOutputBytes: 1, TimestampHeader: true}); err == nil {
+		t.Fatal("Format fit a header in 1 byte")
+	}
+	if len(res.Peers) != 2 {
+		t.Errorf("a failed Format left %d peers in the Result, want it unchanged at 2", len(res.Peers))
+	}
+}
+
+func TestFormatTimestampHeader(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 10, 10))
+	res.Metadata = Metadata{
+		Hosts:     []string{"localhost:26657"},
+		Listeners: map[string][]string{"localhost:26657": {"Listener(@tcp://0.0.0.0:26656)"}},
+		FetchedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	out, err := Format(res, Options{OutputFormat: "commented", TimestampHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out, "\n")
+	if lines[0] != "# generated at 2024-05-01T12:00:00Z" {
+		t.Errorf("first line = %q, want the generation time", lines[0])
+	}
+	if lines[1] != "# listeners of localhost:26657: Listener(@tcp://0.0.0.0:26656)" {
+		t.Errorf("second line = %q, want the listeners", lines[1])
+	}
+
+	out, err = Format(res, Options{OutputFormat: "peerstring", TimestampHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "#") {
+		t.Errorf("peerstring output %q has a comment, want a bare persistent_peers value", out)
+	}
+}
+
+func TestFormatJSONProtocolVersion(t *testing.T) {
+	p := testPeer(1, "a", 10, 10)
+	p.NodeInfo.ProtocolVersion = ProtocolVersion{P2P: "8", Block: "11", App: "3"}
+	out, err := Format(testResult(t, p), Options{OutputFormat: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []struct {
+		ProtocolVersion map[string]string `json:"protocol_version"`
+	}
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"p2p": "8", "block": "11", "app": "3"}
+	if len(records) != 1 || !maps.Equal(records[0].ProtocolVersion, want) {
+		t.Errorf("protocol versions = %+v, want %v", records, want)
+	}
+}
+
+func TestTruncateMoniker(t *testing.T) {
+	for _, tt := range []struct {
+		moniker string
+		max     int
+		want    string
+	}{
+		{"validator-one", 0, "validator-one"},
+		{"validator-one", 13, "validator-one"},
+		{"validator-one", 9, "validato…"},
+		{"ノードアルファ", 4, "ノード…"},
+	} {
+		if got := truncateMoniker(tt.moniker, tt.max); got != tt.want {
+			t.Errorf("truncateMoniker(%q, %d) = %q, want %q", tt.moniker, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestPeerAddressDefaultPort(t *testing.T) {
+	for _, tt := range []struct {
+		listen string
+		want   string
+	}{
+		{"tcp://10.0.0.1:26656", "10.0.0.1:26656"},
+		{"tcp://10.0.0.1", "10.0.0.1:36656"},
+		{"tcp://0.0.0.0", "192.0.2.7:36656"},
+		{"node.example.com", "node.example.com:36656"},
+		{"[2001:db8::1]", "[2001:db8::1]:36656"},
+		{"2001:db8::1", "[2001:db8::1]:36656"},
+	} {
+		p := Peer{NodeInfo: DefaultNodeInfo{ListenAddr: tt.listen}, RemoteIP: "192.0.2.7"}
+		if got := peerAddress(p, 36656); got != tt.want {
+			t.Errorf("peerAddress(%q) = %q, want %q", tt.listen, got, tt.want)
+		}
+	}
+}
+
+func TestFormatCommentedGroups(t *testing.T) {
+	a, b, c, d := testPeer(1, "a", 40, 40), testPeer(2, "b", 30, 30), testPeer(3, "c", 20, 20), testPeer(4, "d", 10, 10)
+	b.NodeInfo.Network = "othernet-2"
+	d.NodeInfo.Network = ""
+	out, err := Format(testResult(t, a, b, c, d), Options{OutputFormat: "commented"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# testnet-1\n" + testID("1") + "@10.0.0.1:26656\n" + testID("3") + "@10.0.0.3:26656\n" +
+		"\n# othernet-2\n" + testID("2") + "@10.0.0.2:26656\n" +
+		"\n# unknown network\n" + testID("4") + "@10.0.0.4:26656\n"
+	if out != want {
+		t.Errorf("commented output =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestFormatConsul(t *testing.T) {
+	p := testPeer(1, "alpha", 10, 10)
+	noRPC := testPeer(2, "beta", 5, 5)
+	noRPC.NodeInfo.Other.RPCAddress = "unix:///var/run/cometbft.sock"
+	out, err := Format(testResult(t, p, noRPC), Options{OutputFormat: "consul", ConsulService: "cometbft-rpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("consul output has %d lines, want 1 for the peer with a TCP RPC address:\n%s", len(lines), out)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"ID":      "cometbft-rpc-" + testID("1"),
+		"Name":    "cometbft-rpc",
+		"Address": "10.0.0.1",
+		"Port":    26657.0,
+		"Tags":    []any{"testnet-1"},
+		"Meta": map[string]any{
+			"node_id": testID("1"),
+			"moniker": "alpha",
+			"p2p":     "10.0.0.1:26656",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("consul service = %v, want %v", got, want)
+	}
+}
+
+func TestFormatJSONConnectionStatus(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 10, 20))
+	decode := func(opts Options) []PeerRecord {
+		t.Helper()
+		opts.OutputFormat = "json"
+		out, err := Format(res, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []PeerRecord
+		if err := json.Unmarshal([]byte(out), &records); err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	if cs := decode(Options{})[0].ConnectionStatus; cs != nil {
+		t.Errorf("connection status %+v written without -include-connection-status", cs)
+	}
+	cs := decode(Options{IncludeConnectionStatus: true})[0].ConnectionStatus
+	if cs == nil {
+		t.Fatal("no connection status with -include-connection-status")
+	}
+	if cs.SendMonitor.Bytes != "10" || cs.RecvMonitor.Bytes != "20" {
+		t.Errorf("monitors sent %s and received %s bytes, want 10 and 20", cs.SendMonitor.Bytes, cs.RecvMonitor.Bytes)
+	}
+	if len(cs.Channels) != 2 || cs.Channels[0].ID != 0x40 || cs.Channels[0].RecentlySent != "10" {
+		t.Errorf("channels = %+v, want 0x40 and 0x20", cs.Channels)
+	}
+}
+
+func TestFormatSystemdEnv(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 20, 20), testPeer(2, "b", 10, 10))
+	out, err := Format(res, Options{OutputFormat: "systemd-env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := testID("1") + "@10.0.0.1:26656," + testID("2") + "@10.0.0.2:26656"
+	if want := "CMTBFT_P2P_PERSISTENT_PEERS=" + peers + "\n"; out != want {
+		t.Errorf("systemd-env output = %q, want %q", out, want)
+	}
+
+	if out, err = Format(res, Options{OutputFormat: "systemd-env", EnvKey: "PEERS"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "PEERS=" + peers + "\n"; out != want {
+		t.Errorf("systemd-env output with a custom key = %q, want %q", out, want)
+	}
+}
+
+func TestFormatIDs(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "a", 10, 10), testPeer(2, "b", 30, 30), testPeer(3, "c", 20, 20))
+	opts := Options{Hosts: []string{host}, TopPeers: 2, OutputFormat: "ids"}
+	res, err := SelectTopPeers(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Format(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(out), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testID("2"), testID("3")}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+func TestFormatSchemePrefix(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 20, 20), testPeer(2, "b", 10, 10))
+	for format, want := range map[string]string{
+		"peerstring": "tcp://" + testID("1") + "@10.0.0.1:26656,tcp://" + testID("2") + "@10.0.0.2:26656",
+		"commented":  "# testnet-1\ntcp://" + testID("1") + "@10.0.0.1:26656\ntcp://" + testID("2") + "@10.0.0.2:26656\n",
+	} {
+		out, err := Format(res, Options{OutputFormat: format, SchemePrefix: "tcp://"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("%s output = %q, want %q", format, out, want)
+		}
+	}
+}
+
+func TestFormatTFVars(t *testing.T) {
+	res := testResult(t, testPeer(1, "a", 20, 20), testPeer(2, "b", 10, 10))
+	out, err := Format(res, Options{OutputFormat: "tfvars"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `persistent_peers = "` + testID("1") + "@10.0.0.1:26656," + testID("2") + `@10.0.0.2:26656"` + "\n"
+	if out != want {
+		t.Errorf("tfvars output = %q, want %q", out, want)
+	}
+	if got, want := hclString(`a"b\c${x}%{y}`), `"a\"b\\c$${x}%%{y}"`; got != want {
+		t.Errorf("hclString = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,900 @@
+// Package peerfilter selects the best-connected peers of a CometBFT node
+// from its net_info RPC endpoint and renders them in formats suitable for
+// node configuration.
+package peerfilter
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout  = 30 * time.Second
+	DefaultHost     = "localhost:26657" // formerly InitialHost
+	DefaultTopPeers = 5                 // top N peers to select
+
+	DefaultP2PPort       = 26656
+	DefaultConsulService = "cometbft-rpc"
+	DefaultCSVColumns    = "node_id,address,moniker,network,total_bytes"
+	DefaultEnvKey        = "CMTBFT_P2P_PERSISTENT_PEERS"
+	DefaultTFVarsKey     = "persistent_peers"
+)
+
+// Options controls how peers are fetched, filtered, ranked and formatted.
+// Zero values for Hosts, TopPeers, Timeout and the format settings select
+// the package defaults.
+//
+// The pointer fields Hysteresis, Denylist, FailMemory, Deltas, Stability,
+// SLA and SinceLastRun carry state between the SelectTopPeers calls that
+// share them, and must not be shared by concurrent calls.
+type Options struct {
+	// Hosts are the RPC endpoints to query. Peers seen by several hosts
+	// are merged, and at least MinHostSuccess of the hosts (a fraction)
+	// must answer.
+	Hosts          []string      `json:"hosts"`
+	MinHostSuccess float64       `json:"min_host_success"`
+	TopPeers       int           `json:"top_peers"`
+	All            bool          `json:"all"` // select every peer that passes the filters, ignoring TopPeers
+	Timeout        time.Duration `json:"timeout"`
+
+	// FromFiles, if set, replaces Hosts with saved net_info responses
+	// read from these paths or glob patterns, merged like Hosts.
+	FromFiles []string `json:"from_files"`
+
+	// AddrBook, if set, replaces Hosts with the peers of a CometBFT
+	// addrbook.json, which have addresses but no traffic stats. With
+	// AddrBookMerge they are merged with the net_info peers instead.
+	AddrBook      string `json:"addrbook"`
+	AddrBookMerge bool   `json:"addrbook_merge"`
+
+	// ConnectTimeout, TLSHandshakeTimeout and ReadTimeout bound the
+	// stages of each net_info request within Timeout. ReadTimeout applies
+	// to waiting for the response headers and, separately, to reading the
+	// body. Zero leaves a stage bounded only by Timeout.
+	ConnectTimeout      time.Duration `json:"connect_timeout"`
+	TLSHandshakeTimeout time.Duration `json:"tls_handshake_timeout"`
+	ReadTimeout         time.Duration `json:"read_timeout"`
+
+	Shuffle        bool          `json:"shuffle"`
+	ShuffleSeed    int64         `json:"shuffle_seed"`  // 0 picks a time-based seed
+	StableOutput   bool          `json:"stable_output"` // order the selected peers by node ID, for minimal diffs
+	MinPassRatio   float64       `json:"min_pass_ratio"`
+	OutputFormat   string        `json:"output_format"`
+	MaxMonikerLen  int           `json:"max_moniker_len"`
+	SortBy         string        `json:"sort_by"`
+	TieBreak       string        `json:"tie_break"` // secondary sort key, one of TieBreakKeys; node_id if empty
+	BlendRatio     float64       `json:"blend_ratio"`
+	DropZeroBytes  bool          `json:"drop_zero_bytes"`
+	DefaultP2PPort int           `json:"default_p2p_port"`
+	MinRecentSent  int64         `json:"min_recent_sent"`
+	MaxPeerAge     time.Duration `json:"max_peer_age"` // drop peers connected longer than this (0 disables)
+	ConsulService  string        `json:"consul_service"`
+	Strict         bool          `json:"strict"`
+	Lean           bool          `json:"lean"`
+	CSVColumns     string        `json:"csv_columns"`
+	EnvKey         string        `json:"env_key"`       // variable name for the systemd-env format
+	TFVarsKey      string        `json:"tfvars_key"`    // variable name for the tfvars format
+	SchemePrefix   string        `json:"scheme_prefix"` // prepended to each id@host:port entry, e.g. "tcp://"
+
+	// ExcludeVersions drops peers whose NodeInfo.Version matches one of
+	// these exact versions or path.Match patterns, e.g. "0.38.*".
+	ExcludeVersions []string `json:"exclude_versions"`
+	// VersionRegex keeps only peers whose NodeInfo.Version matches it,
+	// e.g. to skip forks that are not CometBFT.
+	VersionRegex string `json:"version_regex"`
+	// RequireTxIndex keeps only peers that report tx_index "on".
+	RequireTxIndex bool `json:"require_tx_index"`
+	// RequireVersion drops peers whose NodeInfo.Version is empty or does
+	// not look like a release version such as 0.38.12 or v1.0.0-rc1.
+	RequireVersion bool `json:"require_version"`
+	// SkipPortMismatch drops outbound peers reached on a port other than
+	// the one they advertise. Only peers whose remote_ip includes the
+	// port can be checked.
+	SkipPortMismatch bool `json:"skip_port_mismatch"`
+	// SybilPatterns drops peers whose moniker matches one of these
+	// regular expressions, e.g. names shared by a Sybil cluster.
+	SybilPatterns []string `json:"sybil_patterns"`
+	// CompatMatrix keeps only peers whose ProtocolVersion.Block is a key
+	// and whose ProtocolVersion.App is at least its value; see
+	// ParseCompatMatrix.
+	CompatMatrix map[uint64]uint64 `json:"compat_matrix"`
+
+	// ChannelWeights scales each channel's RecentlySent when ranking by
+	// RankRecentSent or RankSeed; see ParseChannelWeights.
+	ChannelWeights map[byte]float64 `json:"channel_weights"`
+
+	// ProbeRPC drops selected peers whose RPC /health endpoint does not
+	// answer 200 OK within ProbeTimeout. ProbeConcurrency bounds the
+	// probes in flight and defaults to DefaultProbeConcurrency. Both also
+	// apply to the probes of every passing peer made for RankLatency.
+	ProbeRPC         bool          `json:"probe_rpc"`
+	ProbeConcurrency int           `json:"probe_concurrency"`
+	ProbeTimeout     time.Duration `json:"probe_timeout"`
+
+	// OutputEncoding, "raw" or "base64", is applied to the formatted
+	// output. That is the output MaxOutputBytes trims the lowest-ranked
+	// peers from until it fits in this many bytes (0 disables).
+	OutputEncoding string `json:"output_encoding"`
+	MaxOutputBytes int    `json:"max_output_bytes"`
+
+	// Network keeps only peers whose NodeInfo.Network is this chain ID.
+	// If it is empty, DetectNetwork sets it from the /status of Hosts;
+	// when no host answers, peers are not filtered by network. Peers that
+	// report no network, such as address book entries, are kept.
+	Network       string `json:"network"`
+	DetectNetwork bool   `json:"detect_network"`
+
+	// NoResolve writes each peer's listen_addr exactly as advertised,
+	// without replacing 0.0.0.0 with its remote IP, stripping tcp:// or
+	// adding DefaultP2PPort, to see what peers actually announce.
+	NoResolve bool `json:"no_resolve"`
+
+	// CompactPeerString makes the peerstring, systemd-env and tfvars
+	// formats leave out invalid and duplicate entries and keep at most
+	// MaxEntries of them (0 keeps all).
+	CompactPeerString bool `json:"compact_peer_string"`
+	MaxEntries        int  `json:"max_entries"`
+
+	// ASNDatabase is the path of a MaxMind GeoLite2-ASN (or compatible)
+	// database used to tag the selected peers with their ASN and
+	// organization.
+	ASNDatabase string `json:"asn_database"`
+
+	// TimestampHeader adds a "# generated at" line to formats that
+	// support comments.
+	TimestampHeader bool `json:"timestamp_header"`
+
+	IncludeConnectionStatus bool `json:"include_connection_status"`
+	BalanceDirection        bool `json:"balance_direction"`
+	MaximizeChannels        bool `json:"maximize_channels"` // pick peers covering the most distinct channels, see selectCoverage
+	MaxSamePort             int  `json:"max_same_port"`     // select at most this many peers per p2p port (0 disables)
+
+	// BandwidthBudget, if positive, selects the peers covering the most
+	// total bytes whose current rates sum to at most this many bytes/s;
+	// see selectBudget.
+	BandwidthBudget int64 `json:"bandwidth_budget"`
+
+	// FleetSize and FleetIndex spread the selections of several nodes
+	// running this over the ranked peers; see selectFleet. A FleetSize
+	// of 0 disables it.
+	FleetSize  int `json:"fleet_size"`
+	FleetIndex int `json:"fleet_index"`
+
+	RPCMode string `json:"rpc_mode"` // "uri" (GET /net_info) or "jsonrpc" (POST)
+	RPCID   string `json:"rpc_id"`   // request id sent in jsonrpc mode
+
+	// RPCMethod overrides the HTTP method implied by RPCMode, and RPCBody
+	// replaces the request body sent with POST. A custom body in jsonrpc
+	// mode skips the response id check.
+	RPCMethod string `json:"rpc_method"`
+	RPCBody   string `json:"rpc_body"`
+
+	// Anonymize hashes remote IPs and redacts monikers of the selected
+	// peers, and of all peers in the metrics labels and the audit;
+	// AnonymizeIDs also hashes node IDs. AnonymizeSalt keys the
+	// hashes and defaults to a random per-process value.
+	Anonymize     bool   `json:"anonymize"`
+	AnonymizeIDs  bool   `json:"anonymize_ids"`
+	AnonymizeSalt string `json:"-"`
+
+	// Redact blanks these fields of the selected peers in every output
+	// format, named as in the JSON output, e.g. "moniker" or "remote_ip".
+	// They are also blanked in the metrics labels and the audit.
+	Redact []string `json:"redact"`
+
+	// Hysteresis, if set, keeps previously selected peers in the output
+	// across runs that share it.
+	Hysteresis *Hysteresis `json:"hysteresis"`
+
+	// Denylist, if set, excludes the node IDs it lists.
+	Denylist *Denylist `json:"denylist"`
+
+	// FailMemory, if set, is loaded at the start of each run and excludes
+	// the peers whose dial failed within its cooldown.
+	FailMemory *FailMemory `json:"fail_memory"`
+
+	// Deltas, if set, tracks byte counters across runs for RankDelta.
+	Deltas *Deltas `json:"deltas"`
+
+	// Stability, if set, tracks rate histories across runs for
+	// RankStability, RankWeightedRate and Sparklines.
+	Stability *Stability `json:"stability"`
+
+	// Sparklines adds each peer's recent rates, from Stability, to the md
+	// table as a sparkline.
+	Sparklines bool `json:"sparklines"`
+
+	// SLA, if set, checks the selected peers and reports violations in
+	// Result.Alerts.
+	SLA *SLA `json:"sla"`
+
+	// SinceLastRun, if set, outputs only the peers the previous run did
+	// not select. Its state is only updated by SinceLastRun.Save.
+	SinceLastRun *SinceLastRun `json:"since_last_run"`
+
+	// Flags are the command-line settings a run was configured with, by
+	// flag name, including those only the CLI uses. They are not read
+	// here, only listed in the config of the full-json format.
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Validate reports combinations of options that cannot work together.
+func (o Options) Validate() error {
+	if o.TopPeers < 0 {
+		return fmt.Errorf("top must not be negative, got %d", o.TopPeers)
+	}
+	if o.SortBy != "" {
+		if _, err := ParseRankKey(o.SortBy); err != nil {
+			return err
+		}
+	}
+	if o.TieBreak != "" {
+		if _, err := ParseTieBreak(o.TieBreak); err != nil {
+			return err
+		}
+	}
+	if !(o.MinHostSuccess >= 0 && o.MinHostSuccess <= 1) {
+		return fmt.Errorf("min host success must be a fraction between 0 and 1, got %g", o.MinHostSuccess)
+	}
+	if !(o.BlendRatio >= 0 && o.BlendRatio <= 1) {
+		return fmt.Errorf("blend ratio must be between 0 and 1, got %g", o.BlendRatio)
+	}
+	if o.Lean && o.SortBy != "" && o.SortBy != string(RankBytes) {
+		return fmt.Errorf("-lean only decodes bytes and cannot be used with -sort-by=%s", o.SortBy)
+	}
+	if len(o.ChannelWeights) > 0 {
+		switch RankKey(o.SortBy) {
+		case RankRecentSent, RankSeed:
+		default:
+			return fmt.Errorf("channel weights only apply to -sort-by=%s or %s", RankRecentSent, RankSeed)
+		}
+	}
+	for _, pattern := range o.ExcludeVersions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid version pattern %q: %w", pattern, err)
+		}
+	}
+	if o.VersionRegex != "" {
+		if _, err := regexp.Compile(o.VersionRegex); err != nil {
+			return fmt.Errorf("invalid version regex: %w", err)
+		}
+	}
+	for _, pattern := range o.SybilPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid sybil pattern %q: %w", pattern, err)
+		}
+	}
+	if o.Lean && len(o.SybilPatterns) > 0 {
+		return fmt.Errorf("-lean does not decode monikers and cannot be used with -sybil-patterns")
+	}
+	if o.Lean && (len(o.ExcludeVersions) > 0 || o.VersionRegex != "") {
+		return fmt.Errorf("-lean does not decode peer versions and cannot be used with -exclude-version or -version-regex")
+	}
+	if o.Lean && len(o.CompatMatrix) > 0 {
+		return fmt.Errorf("-lean does not decode protocol versions and cannot be used with -compat-matrix")
+	}
+	if o.Lean && o.Network != "" {
+		return fmt.Errorf("-lean does not decode peer networks and cannot be used with -network")
+	}
+	if o.Lean && o.RequireVersion {
+		return fmt.Errorf("-lean does not decode peer versions and cannot be used with -require-version")
+	}
+	if o.Lean && o.SkipPortMismatch {
+		return fmt.Errorf("-lean does not decode peer directions and cannot be used with -skip-port-mismatch")
+	}
+	if o.Lean && o.RequireTxIndex {
+		return fmt.Errorf("-lean does not decode tx_index and cannot be used with -require-txindex")
+	}
+	if o.Lean && o.ProbeRPC {
+		return fmt.Errorf("-lean does not decode RPC addresses and cannot be used with -probe-rpc")
+	}
+	if o.Lean && o.SLA != nil {
+		return fmt.Errorf("-lean skips the rate and idle fields that SLA checks need")
+	}
+	if o.Lean && (o.TieBreak == "moniker" || o.TieBreak == "duration") {
+		return fmt.Errorf("-lean does not decode %ss and cannot be used with -sort-stable-secondary=%s", o.TieBreak, o.TieBreak)
+	}
+	if o.Lean && o.MaxPeerAge > 0 {
+		return fmt.Errorf("-lean does not decode connection durations and cannot be used with -max-peer-age")
+	}
+	if o.MaxPeerAge < 0 {
+		return fmt.Errorf("max peer age must not be negative, got %s", o.MaxPeerAge)
+	}
+	if o.Sparklines && o.Stability == nil {
+		return fmt.Errorf("sparklines need a rate history (Options.Stability)")
+	}
+	if o.Lean && o.Sparklines {
+		return fmt.Errorf("-lean does not decode rates and cannot be used with -sparklines")
+	}
+	if o.Lean && o.Strict {
+		return fmt.Errorf("-lean skips the rate and duration fields that -strict checks")
+	}
+	if o.AddrBookMerge && o.AddrBook == "" {
+		return fmt.Errorf("-addrbook-merge needs -addrbook")
+	}
+	if err := checkRedactFields(o.Redact); err != nil {
+		return err
+	}
+	if o.MaxSamePort < 0 {
+		return fmt.Errorf("max same port must not be negative, got %d", o.MaxSamePort)
+	}
+	if o.FailMemory != nil && o.FailMemory.Cooldown <= 0 {
+		return fmt.Errorf("fail memory cooldown must be positive, got %s", o.FailMemory.Cooldown)
+	}
+	if o.MaxEntries < 0 {
+		return fmt.Errorf("max entries must not be negative, got %d", o.MaxEntries)
+	}
+	if o.MaxEntries > 0 && !o.CompactPeerString {
+		return fmt.Errorf("-max-entries needs -compact-peerstring")
+	}
+	if o.OutputFormat == "full-json" && (o.Anonymize || len(o.Redact) > 0) {
+		return fmt.Errorf("-output-format=full-json lists every peer as fetched and cannot be used with -anonymize or -redact")
+	}
+	if o.OutputFormat == "full-json" && o.MaxOutputBytes > 0 {
+		return fmt.Errorf("-output-format=full-json cannot be trimmed with -max-output-bytes")
+	}
+	if o.CompactPeerString && o.Anonymize && o.AnonymizeIDs {
+		return fmt.Errorf("-compact-peerstring drops the hashed node IDs of -anonymize-ids as invalid")
+	}
+	if o.CompactPeerString && (slices.Contains(o.Redact, "node_id") || slices.Contains(o.Redact, "address")) {
+		return fmt.Errorf("-compact-peerstring drops entries whose node_id or address is redacted")
+	}
+	if o.Shuffle && o.StableOutput {
+		return fmt.Errorf("-shuffle and -stable-output cannot be combined")
+	}
+	if o.FleetSize < 0 || (o.FleetSize > 0 && (o.FleetIndex < 0 || o.FleetIndex >= o.FleetSize)) {
+		return fmt.Errorf("fleet index %d out of range for fleet size %d", o.FleetIndex, o.FleetSize)
+	}
+	if o.FleetSize > 0 && (o.BalanceDirection || o.Hysteresis != nil) {
+		return fmt.Errorf("fleet selection cannot be combined with -balance-direction or hysteresis")
+	}
+	if o.MaximizeChannels && (o.BalanceDirection || o.Hysteresis != nil || o.FleetSize > 0) {
+		return fmt.Errorf("-maximize-channel-coverage cannot be combined with -balance-direction, hysteresis or fleet selection")
+	}
+	if o.BandwidthBudget > 0 && (o.MaximizeChannels || o.BalanceDirection || o.Hysteresis != nil || o.FleetSize > 0) {
+		return fmt.Errorf("-bandwidth-budget cannot be combined with another selection mode")
+	}
+	if o.Lean && o.BandwidthBudget > 0 {
+		return fmt.Errorf("-lean does not decode rates and cannot be used with -bandwidth-budget")
+	}
+	if o.Lean && o.MaximizeChannels {
+		return fmt.Errorf("-lean does not decode channels and cannot be used with -maximize-channel-coverage")
+	}
+	if o.Hysteresis != nil && o.BalanceDirection {
+		return fmt.Errorf("hysteresis cannot be combined with -balance-direction")
+	}
+	d := o.withDefaults()
+	switch d.RPCMethod {
+	case http.MethodGet:
+		if d.RPCMode == "jsonrpc" {
+			return fmt.Errorf("-rpc-mode=jsonrpc requires -rpc-method=POST")
+		}
+		if d.RPCBody != "" {
+			return fmt.Errorf("-rpc-body requires -rpc-method=POST")
+		}
+	case http.MethodPost:
+	default:
+		return fmt.Errorf("unsupported rpc method %q, want GET or POST", o.RPCMethod)
+	}
+	if _, err := encodeOutput("", o.OutputEncoding); err != nil {
+		return err
+	}
+	if o.OutputFormat == "csv" {
+		if _, err := parseCSVColumns(o.CSVColumns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.Hosts) == 0 {
+		o.Hosts = []string{DefaultHost}
+	}
+	if o.TopPeers == 0 {
+		o.TopPeers = DefaultTopPeers
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.SortBy == "" {
+		o.SortBy = string(RankBytes)
+	}
+	if o.RPCMode == "" {
+		o.RPCMode = "uri"
+	}
+	if o.RPCID == "" {
+		o.RPCID = "1"
+	}
+	o.RPCMethod = strings.ToUpper(o.RPCMethod)
+	if o.RPCMethod == "" {
+		o.RPCMethod = http.MethodGet
+		if o.RPCMode == "jsonrpc" {
+			o.RPCMethod = http.MethodPost
+		}
+	}
+	if o.OutputFormat == "" {
+		o.OutputFormat = "peerstring"
+	}
+	if o.DefaultP2PPort == 0 {
+		o.DefaultP2PPort = DefaultP2PPort
+	}
+	if o.ConsulService == "" {
+		o.ConsulService = DefaultConsulService
+	}
+	if o.CSVColumns == "" {
+		o.CSVColumns = DefaultCSVColumns
+	}
+	if o.EnvKey == "" {
+		o.EnvKey = DefaultEnvKey
+	}
+	if o.TFVarsKey == "" {
+		o.TFVarsKey = DefaultTFVarsKey
+	}
+	if o.ProbeConcurrency <= 0 {
+		o.ProbeConcurrency = DefaultProbeConcurrency
+	}
+	if o.ProbeTimeout == 0 {
+		o.ProbeTimeout = o.Timeout
+	}
+	return o
+}
+
+// Result is the outcome of one selection run.
+type Result struct {
+	// Peers are the selected peers in output order.
+	Peers      []PeerRecord
+	Aggregates Aggregates
+	Metadata   Metadata
+
+	// Alerts lists the selected peers that violated Options.SLA.
+	Alerts []SLAAlert
+
+	all      []peerWithBytes
+	passed   []peerWithBytes
+	selected []peerWithBytes
+	filters  []string    // names of the filters applied, in order
+	redact   []string    // Options.Redact, see scrub
+	anon     *anonymizer // set with Options.Anonymize, see scrub
+}
+
+// Aggregates summarizes the full peer set of a run.
+type Aggregates struct {
+	TotalPeers    int   `json:"total_peers"`
+	PassedPeers   int   `json:"passed_peers"`
+	SelectedPeers int   `json:"selected_peers"`
+	TotalBytes    int64 `json:"total_bytes"`
+
+	// ResponseBytes is the size of the net_info responses and BytesPerPeer
+	// its average per reported peer, as a measure of RPC load.
+	ResponseBytes int64   `json:"response_bytes"`
+	BytesPerPeer  float64 `json:"bytes_per_peer"`
+
+	// Gini is the Gini coefficient of the bytes of all peers, from 0 for
+	// evenly spread traffic to near 1 when one peer carries all of it.
+	Gini float64 `json:"gini"`
+
+	// FilterDrops counts the peers each enabled filter dropped, keyed by
+	// the flag that enables it.
+	FilterDrops map[string]int `json:"filter_drops,omitempty"`
+}
+
+// Metadata describes where and how a Result was produced.
+type Metadata struct {
+	Hosts  []string `json:"hosts"`
+	SortBy string   `json:"sort_by"`
+	// Listeners are the listen addresses each host reports for itself.
+	Listeners map[string][]string `json:"listeners,omitempty"`
+	FetchedAt time.Time           `json:"fetched_at"`
+	// Network is the chain ID peers were restricted to, if any.
+	Network string `json:"network,omitempty"`
+}
+
+// SelectTopPeers fetches net_info from opts.Hosts, or reads it from
+// opts.FromFiles or opts.AddrBook, filters and ranks the peers and returns
+// the top opts.TopPeers of them, or all of them with opts.All. Options
+// that fail Validate are returned as an error.
+func SelectTopPeers(ctx context.Context, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+
+	peersWithBytes, sources, stats, err := collectPeers(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	fetchedAt := time.Now()
+
+	checkClockSkew(peersWithBytes, fetchedAt)
+	checkPortMismatch(peersWithBytes)
+	if opts.TimestampHeader {
+		checkListeners(stats.listeners)
+	}
+
+	allPeers := peersWithBytes
+	if opts.Deltas != nil {
+		opts.Deltas.apply(allPeers)
+	}
+	if opts.Stability != nil {
+		opts.Stability.apply(allPeers)
+	}
+	versionLevel := log.DebugLevel
+	if opts.VersionRegex != "" || len(opts.ExcludeVersions) > 0 {
+		versionLevel = log.InfoLevel
+	}
+	logVersions(allPeers, versionLevel)
+
+	if opts.Denylist != nil {
+		opts.Denylist.refresh(ctx, opts.Timeout)
+	}
+	if opts.FailMemory != nil {
+		if err := opts.FailMemory.Load(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Network == "" && opts.DetectNetwork && !opts.Lean && len(opts.FromFiles) == 0 && (opts.AddrBook == "" || opts.AddrBookMerge) {
+		if opts.Network, err = detectNetwork(ctx, opts.Hosts, opts); err != nil {
+			return nil, err
+		}
+		if opts.Network != "" {
+			log.Infof("Keeping peers on network %s, detected from /status", opts.Network)
+		}
+	}
+	filters, err := peerFilters(opts)
+	if err != nil {
+		return nil, err
+	}
+	peersWithBytes, drops := filterPeers(peersWithBytes, filters)
+	for _, f := range filters {
+		log.Debugf("Filter %s dropped %d peers", f.name, drops[f.name])
+	}
+	if n := drops["fail-memory"]; n > 0 {
+		log.Infof("Excluded %d peers whose dial failed within the last %s", n, opts.FailMemory.Cooldown)
+	}
+	if n := drops["network"]; n > 0 {
+		log.Infof("Excluded %d peers on networks other than %s", n, opts.Network)
+	}
+	if n := drops["require-version"]; n > 0 {
+		log.Infof("Excluded %d peers without a valid version", n)
+	}
+	if n := drops["sybil-patterns"]; n > 0 {
+		log.Infof("Excluded %d peers with monikers matching Sybil patterns", n)
+	}
+	checkPassRatio(len(peersWithBytes), len(allPeers), opts.MinPassRatio)
+
+	if opts.SortBy == string(RankLatency) {
+		measureLatency(ctx, peersWithBytes, opts.ProbeConcurrency, opts.ProbeTimeout)
+	}
+
+	// Sort the peers by the selected key in descending order.
+	if err := sortPeers(peersWithBytes, RankKey(opts.SortBy), opts.BlendRatio, opts.TieBreak); err != nil {
+		return nil, err
+	}
+	for i := range peersWithBytes {
+		peersWithBytes[i].rank = i + 1
+	}
+
+	// Select the top N peers.
+	candidates := peersWithBytes
+	if opts.MaxSamePort > 0 {
+		candidates = capSamePort(candidates, opts.MaxSamePort)
+	}
+	if opts.All {
+		opts.TopPeers = len(candidates)
+	}
+	var topPeers []peerWithBytes
+	switch {
+	case opts.BalanceDirection:
+		topPeers = selectBalanced(candidates, opts.TopPeers)
+	case opts.Hysteresis != nil:
+		topPeers = opts.Hysteresis.apply(candidates, opts.TopPeers)
+	case opts.FleetSize > 0:
+		topPeers = selectFleet(candidates, opts.TopPeers, opts.FleetIndex, opts.FleetSize)
+	case opts.MaximizeChannels:
+		topPeers = selectCoverage(candidates, opts.TopPeers)
+	case opts.BandwidthBudget > 0:
+		topPeers = selectBudget(candidates, opts.TopPeers, opts.BandwidthBudget)
+	default:
+		topCount := opts.TopPeers
+		if len(candidates) < topCount {
+			topCount = len(candidates)
+		}
+		// A copy, so reordering the output below keeps passed, which the
+		// audit and full-json list, in rank order.
+		topPeers = slices.Clone(candidates[:topCount])
+	}
+
+	if opts.ProbeRPC {
+		topPeers = probeRPC(ctx, topPeers, opts.ProbeConcurrency, opts.ProbeTimeout)
+	}
+
+	if opts.ASNDatabase != "" {
+		if err := annotateASN(topPeers, opts.ASNDatabase); err != nil {
+			return nil, err
+		}
+	}
+
+	var alerts []SLAAlert
+	if opts.SLA != nil {
+		alerts = opts.SLA.check(topPeers)
+	}
+
+	if opts.SinceLastRun != nil {
+		if topPeers, err = opts.SinceLastRun.apply(topPeers); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Shuffle {
+		seed := opts.ShuffleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		shufflePeers(topPeers, rand.New(rand.NewSource(seed)))
+	}
+
+	var anon *anonymizer
+	if opts.Anonymize {
+		a := newAnonymizer(opts.AnonymizeSalt, opts.AnonymizeIDs)
+		anon = &a
+		topPeers = anon.apply(topPeers)
+	}
+
+	if len(opts.Redact) > 0 {
+		topPeers = slices.Clone(topPeers)
+		redact(topPeers, opts.Redact)
+	}
+
+	if opts.StableOutput {
+		sortByNodeID(topPeers)
+	}
+
+	res := &Result{
+		Aggregates: Aggregates{
+			TotalPeers:    len(allPeers),
+			PassedPeers:   len(peersWithBytes),
+			SelectedPeers: len(topPeers),
+			ResponseBytes: stats.responseBytes,
+			BytesPerPeer:  stats.bytesPerPeer(),
+			FilterDrops:   drops,
+		},
+		Metadata: Metadata{
+			Hosts:     sources,
+			SortBy:    opts.SortBy,
+			Listeners: stats.listeners,
+			FetchedAt: fetchedAt,
+			Network:   opts.Network,
+		},
+		Alerts:   alerts,
+		all:      allPeers,
+		passed:   peersWithBytes,
+		selected: topPeers,
+		redact:   opts.Redact,
+		anon:     anon,
+	}
+	for _, f := range filters {
+		res.filters = append(res.filters, f.name)
+	}
+	byteCounts := make([]int64, 0, len(allPeers))
+	for _, p := range allPeers {
+		res.Aggregates.TotalBytes += p.totalBytes
+		byteCounts = append(byteCounts, p.totalBytes)
+	}
+	res.Aggregates.Gini = gini(byteCounts)
+	for _, p := range topPeers {
+		res.Peers = append(res.Peers, newPeerRecord(p))
+	}
+	return res, nil
+}
+
+// collectPeers gathers the peers of a run from the sources opts selects:
+// the net_info of opts.Hosts or opts.FromFiles, the address book, or
+// both merged. It also returns the names of the sources used.
+func collectPeers(ctx context.Context, opts Options) ([]peerWithBytes, []string, fetchStats, error) {
+	var peers []peerWithBytes
+	var sources []string
+	var stats fetchStats
+	if opts.AddrBook == "" || opts.AddrBookMerge {
+		sources = opts.Hosts
+		if len(opts.FromFiles) > 0 {
+			files, err := expandFiles(opts.FromFiles)
+			if err != nil {
+				return nil, nil, fetchStats{}, err
+			}
+			sources = files
+		}
+		var err error
+		peers, stats, err = fetchAllPeers(ctx, sources, opts.MinHostSuccess, opts)
+		if err != nil {
+			return nil, nil, fetchStats{}, err
+		}
+	}
+	if opts.AddrBook != "" {
+		book, err := readAddrBook(opts.AddrBook, opts.DefaultP2PPort)
+		if err != nil {
+			return nil, nil, fetchStats{}, err
+		}
+		log.Debugf("Address book %s lists %d peers", opts.AddrBook, len(book))
+		peers = mergePeers([][]peerWithBytes{peers, book})
+		sources = append(slices.Clip(sources), opts.AddrBook)
+	}
+	return peers, sources, stats, nil
+}
+
+// newPeerWithBytes parses the byte, rate and duration fields of p. Fields
+// that fail to parse count as zero, and the first such failure is returned
+// alongside the result. weights scale each channel's RecentlySent in the
+// weighted sum used for ranking.
+func newPeerWithBytes(p Peer, defaultPort int, weights map[byte]float64) (peerWithBytes, error) {
+	var firstErr error
+	parse := func(field, s string) int64 {
+		v, err := parseBytes(s)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid %s %q", field, s)
+			}
+			return 0
+		}
+		return v
+	}
+
+	remoteIP, remotePort := splitRemoteIP(p.RemoteIP)
+	p.RemoteIP = normalizeIP(remoteIP)
+	cs := p.ConnectionStatus
+	// Parse the "Bytes" fields from both SendMonitor and RecvMonitor.
+	total := parse("send bytes", cs.SendMonitor.Bytes) + parse("recv bytes", cs.RecvMonitor.Bytes)
+	sendRate := parse("send rate", cs.SendMonitor.CurRate)
+	rate := sendRate + parse("recv rate", cs.RecvMonitor.CurRate)
+	samples := parse("send samples", cs.SendMonitor.Samples) + parse("recv samples", cs.RecvMonitor.Samples)
+	var recentSent int64
+	var weighted float64
+	for _, ch := range cs.Channels {
+		sent := parse(fmt.Sprintf("channel %#x recently sent", ch.ID), ch.RecentlySent)
+		recentSent += sent
+		weighted += channelWeight(weights, ch.ID) * float64(sent)
+	}
+	parseDur := func(s string) time.Duration {
+		d, err := parseDuration(s)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return d
+	}
+	duration := parseDur(cs.Duration)
+	idle := min(parseDur(cs.SendMonitor.Idle), parseDur(cs.RecvMonitor.Idle))
+
+	return peerWithBytes{
+		peer:       p,
+		totalBytes: total,
+		curRate:    rate,
+		sendRate:   sendRate,
+		recentSent: recentSent,
+		weighted:   weighted,
+		samples:    samples,
+		duration:   duration,
+		idle:       idle,
+		channels:   distinctChannels(p.NodeInfo.Channels),
+		address:    peerAddress(p, defaultPort),
+		remotePort: remotePort,
+	}, firstErr
+}
+
+// normalizeIP rewrites an IPv4-mapped IPv6 address such as ::ffff:1.2.3.4
+// to plain IPv4, so it matches IPv4 lookups and forms a valid host:port.
+// Other values are returned unchanged.
+func normalizeIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil || !strings.Contains(s, ":") {
+		return s
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return s
+}
+
+// distinctChannels decodes the advertised channel IDs, dropping duplicates.
+// Channels that cannot be decoded yield nil.
+func distinctChannels(channels HexBytes) []byte {
+	ids, err := channels.Decode()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[byte]bool, len(ids))
+	var distinct []byte
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			distinct = append(distinct, id)
+		}
+	}
+	return distinct
+}
+
+// checkListeners warns about hosts listening on all interfaces, which may
+// expose them more widely than intended.
+func checkListeners(listeners map[string][]string) {
+	for host, addrs := range listeners {
+		for _, addr := range addrs {
+			if strings.Contains(addr, "0.0.0.0") {
+				log.Warnf("Host %s listens on all interfaces (%s)", host, addr)
+			}
+		}
+	}
+}
+
+// checkClockSkew warns about peers whose send monitor started in the future
+// relative to now, which points at clock skew or bad data. It returns the
+// number of such peers.
+func checkClockSkew(peers []peerWithBytes, now time.Time) int {
+	skewed := 0
+	for _, p := range peers {
+		start := p.peer.ConnectionStatus.SendMonitor.Start
+		if start.IsZero() || !start.After(now) {
+			continue
+		}
+		skewed++
+		log.Warnf("Peer %s (%s) connection started %s in the future; clock skew or bad data",
+			p.peer.NodeInfo.DefaultNodeID, p.peer.RemoteIP, start.Sub(now))
+	}
+	return skewed
+}
+
+// shufflePeers randomizes the order of peers in place using rng.
+func shufflePeers(peers []peerWithBytes, rng *rand.Rand) {
+	rng.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+}
+
+// sortByNodeID orders peers in place by node ID, so the output of a
+// stable selection does not change when only the ranking does.
+func sortByNodeID(peers []peerWithBytes) {
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].peer.NodeInfo.DefaultNodeID < peers[j].peer.NodeInfo.DefaultNodeID
+	})
+}
+
+// parseBytes converts a string (assumed to represent a number) to int64.
+// On error, it returns 0.
+func parseBytes(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseDuration parses a duration reported by CometBFT. It accepts integer
+// nanoseconds ("3600000000000"), Go duration strings ("1h") and float
+// seconds ("3600.5"), but not NaN or infinities.
+func parseDuration(s string) (time.Duration, error) {
+	if ns, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(ns), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// addPrefix ensures the URL has an "http://" prefix.
+func addPrefix(host string) string {
+	if strings.HasPrefix(host, "http") {
+		return host
+	}
+	return fmt.Sprintf("http://%s", host)
+}
@@ -0,0 +1,375 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus/hooks/test"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testID returns a valid 40-character node ID built from c.
+func testID(c string) string {
+	return strings.Repeat(c, 40/len(c))
+}
+
+// testPeer returns an inbound net_info peer at 10.0.0.n that has sent
+// and received the given bytes over an hour-long connection.
+func testPeer(n int, moniker string, sent, recv int64) Peer {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := func(bytes int64) Status {
+		return Status{
+			Start:    start,
+			Bytes:    strconv.FormatInt(bytes, 10),
+			Samples:  "10",
+			CurRate:  "100",
+			Duration: "3600000000000",
+			Idle:     "1000000000",
+		}
+	}
+	ip := fmt.Sprintf("10.0.0.%d", n)
+	return Peer{
+		NodeInfo: DefaultNodeInfo{
+			ProtocolVersion: ProtocolVersion{P2P: "8", Block: "11", App: "0"},
+			DefaultNodeID:   testID(strconv.Itoa(n % 10)),
+			ListenAddr:      "tcp://" + ip + ":26656",
+			Network:         "testnet-1",
+			Version:         "0.38.12",
+			Channels:        "4020",
+			Moniker:         moniker,
+			Other:           DefaultNodeInfoOther{TxIndex: "on", RPCAddress: "tcp://0.0.0.0:26657"},
+		},
+		ConnectionStatus: ConnectionStatus{
+			Duration:    "3600000000000",
+			SendMonitor: status(sent),
+			RecvMonitor: status(recv),
+			Channels: []ChannelStatus{
+				{ID: 0x40, RecentlySent: "10"},
+				{ID: 0x20, RecentlySent: "0"},
+			},
+		},
+		RemoteIP: ip,
+	}
+}
+
+// netInfoBody returns a net_info response listing peers.
+func netInfoBody(tb testing.TB, peers ...Peer) []byte {
+	tb.Helper()
+	body, err := json.Marshal(CometBFTNetInfoResult{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Result: ResultNetInfo{
+			Listening: true,
+			Listeners: []string{"Listener(@tcp://0.0.0.0:26656)"},
+			NPeers:    strconv.Itoa(len(peers)),
+			Peers:     peers,
+		},
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return body
+}
+
+// serveNetInfo starts an RPC stub that answers /net_info with peers and
+// returns its URL.
+func serveNetInfo(t *testing.T, peers ...Peer) string {
+	t.Helper()
+	body := netInfoBody(t, peers...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/net_info" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// writeNetInfo saves a net_info response listing peers in a temporary
+// file and returns its path.
+func writeNetInfo(t *testing.T, peers ...Peer) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "net_info.json")
+	if err := os.WriteFile(path, netInfoBody(t, peers...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// parsedPeers parses peers as SelectTopPeers does.
+func parsedPeers(t *testing.T, peers ...Peer) []peerWithBytes {
+	t.Helper()
+	parsed := make([]peerWithBytes, 0, len(peers))
+	for _, p := range peers {
+		pwb, err := newPeerWithBytes(p, DefaultP2PPort, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, pwb)
+	}
+	return parsed
+}
+
+// monikers returns the monikers of records in order.
+func monikers(records []PeerRecord) []string {
+	names := make([]string, 0, len(records))
+	for _, r := range records {
+		names = append(names, r.Moniker)
+	}
+	return names
+}
+
+func TestSelectTopPeers(t *testing.T) {
+	host := serveNetInfo(t,
+		testPeer(1, "small", 100, 100),
+		testPeer(2, "large", 5000, 5000),
+		testPeer(3, "medium", 1000, 1000),
+	)
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(monikers(res.Peers), ","), "large,medium"; got != want {
+		t.Errorf("selected %s, want %s", got, want)
+	}
+	if res.Aggregates.TotalPeers != 3 || res.Aggregates.SelectedPeers != 2 {
+		t.Errorf("aggregates = %+v, want 3 peers with 2 selected", res.Aggregates)
+	}
+	out, err := Format(res, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testID("2") + "@10.0.0.2:26656," + testID("3") + "@10.0.0.3:26656"
+	if out != want {
+		t.Errorf("Format = %q, want %q", out, want)
+	}
+}
+
+func TestSelectTopPeersValidates(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "a", 1, 1), testPeer(2, "b", 2, 2))
+	_, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, FleetSize: 2, FleetIndex: -1})
+	if err == nil || !strings.Contains(err.Error(), "fleet index") {
+		t.Fatalf("SelectTopPeers with a negative fleet index: err = %v, want a fleet index error", err)
+	}
+}
+
+func TestValidateBlendRatio(t *testing.T) {
+	for _, ratio := range []float64{0, 0.5, 1} {
+		if err := (Options{BlendRatio: ratio}).Validate(); err != nil {
+			t.Errorf("blend ratio %g: %v", ratio, err)
+		}
+	}
+	for _, ratio := range []float64{-0.1, 1.5} {
+		if err := (Options{BlendRatio: ratio}).Validate(); err == nil {
+			t.Errorf("blend ratio %g was accepted", ratio)
+		}
+	}
+}
+
+func TestShufflePeersSeeded(t *testing.T) {
+	var peers []Peer
+	for i := range 8 {
+		peers = append(peers, testPeer(i, strconv.Itoa(i), int64(100-i), 0))
+	}
+	ranked := parsedPeers(t, peers...)
+	shuffle := func(seed int64) []string {
+		p := slices.Clone(ranked)
+		shufflePeers(p, rand.New(rand.NewSource(seed)))
+		return rankedMonikers(p)
+	}
+
+	first, again := shuffle(42), shuffle(42)
+	if !slices.Equal(first, again) {
+		t.Errorf("seed 42 gave %v and then %v, want the same order", first, again)
+	}
+	if slices.Equal(first, rankedMonikers(ranked)) {
+		t.Errorf("seed 42 kept the ranked order %v", first)
+	}
+	sorted := slices.Clone(first)
+	slices.Sort(sorted)
+	want := rankedMonikers(ranked)
+	slices.Sort(want)
+	if !slices.Equal(sorted, want) {
+		t.Errorf("shuffled set %v, want the same peers as %v", first, want)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	hour := time.Hour
+	for s, want := range map[string]time.Duration{
+		"3600000000000": hour,
+		"1h":            hour,
+		"3600.5":        hour + 500*time.Millisecond,
+	} {
+		got, err := parseDuration(s)
+		if err != nil || got != want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"an hour", "NaN", "Inf", "-Inf", "+inf"} {
+		if d, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", s, d)
+		}
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	future := testPeer(2, "future", 10, 10)
+	future.ConnectionStatus.SendMonitor.Start = now.Add(time.Hour)
+	peers := parsedPeers(t, testPeer(1, "past", 10, 10), future)
+	if got := checkClockSkew(peers, now); got != 1 {
+		t.Errorf("checkClockSkew found %d skewed peers, want 1", got)
+	}
+}
+
+func TestSelectTopPeersAll(t *testing.T) {
+	var peers []Peer
+	for i := 1; i <= 9; i++ {
+		peers = append(peers, testPeer(i, strconv.Itoa(i), int64(100-i), 0))
+	}
+	opts := Options{Hosts: []string{serveNetInfo(t, peers...)}, TopPeers: 3, All: true}
+	res, err := SelectTopPeers(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"peerstring", "json", "ids", "csv"} {
+		opts.OutputFormat = format
+		out, err := Format(res, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range peers {
+			if !strings.Contains(out, p.NodeInfo.DefaultNodeID) {
+				t.Errorf("%s output with all set lacks peer %s", format, p.NodeInfo.Moniker)
+			}
+		}
+	}
+}
+
+func TestListenersReported(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	host := serveNetInfo(t, testPeer(1, "a", 10, 10))
+	opts := Options{Hosts: []string{host}, OutputFormat: "commented", TimestampHeader: true}
+	res, err := SelectTopPeers(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Listener(@tcp://0.0.0.0:26656)"}
+	if got := res.Metadata.Listeners[host]; !slices.Equal(got, want) {
+		t.Errorf("listeners of %s = %v, want %v", host, got, want)
+	}
+	out, err := Format(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := "# listeners of " + host + ": " + want[0] + "\n"; !strings.Contains(out, line) {
+		t.Errorf("output %q lacks the header line %q", out, line)
+	}
+	var warned bool
+	for _, e := range hook.AllEntries() {
+		warned = warned || strings.Contains(e.Message, "listens on all interfaces")
+	}
+	if !warned {
+		t.Error("listening on 0.0.0.0 was not warned about")
+	}
+}
+
+func TestStableOutput(t *testing.T) {
+	host := serveNetInfo(t,
+		testPeer(3, "c", 900, 900),
+		testPeer(1, "a", 100, 100),
+		testPeer(4, "d", 500, 500),
+		testPeer(2, "b", 700, 700),
+	)
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 3, StableOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The top 3 by bytes are c, b and d, written in node ID order.
+	if got := strings.Join(monikers(res.Peers), ","); got != "b,c,d" {
+		t.Errorf("stable output order %s, want b,c,d", got)
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	for in, want := range map[string]string{
+		"::ffff:10.0.0.1": "10.0.0.1",
+		"10.0.0.1":        "10.0.0.1",
+		"2001:db8::1":     "2001:db8::1",
+		"not an ip":       "not an ip",
+	} {
+		if got := normalizeIP(in); got != want {
+			t.Errorf("normalizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	mapped := testPeer(1, "mapped", 10, 10)
+	mapped.RemoteIP = "::ffff:10.0.0.1"
+	mapped.NodeInfo.ListenAddr = "tcp://0.0.0.0:26656"
+	res, err := SelectTopPeers(context.Background(), Options{
+		Hosts:       []string{serveNetInfo(t, mapped)},
+		ASNDatabase: writeASNDatabase(t, 64500, "Example Net"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := res.Peers[0]
+	if p.RemoteIP != "10.0.0.1" || p.Address != "10.0.0.1:26656" {
+		t.Errorf("mapped peer has remote IP %s and address %s, want 10.0.0.1 and 10.0.0.1:26656", p.RemoteIP, p.Address)
+	}
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	if ip := net.ParseIP(p.RemoteIP); !cidr.Contains(ip) || len(ip.To4()) != net.IPv4len {
+		t.Errorf("remote IP %s is not an IPv4 address in %s", p.RemoteIP, cidr)
+	}
+	if p.ASN != 64500 {
+		t.Errorf("mapped peer tagged AS%d, want AS64500 from 10.0.0.0/8", p.ASN)
+	}
+}
+
+func TestOutputOrderKeepsRankOrder(t *testing.T) {
+	var peers []Peer
+	for i := 1; i <= 6; i++ {
+		// Node IDs sort in the reverse of rank order.
+		peers = append(peers, testPeer(i, strconv.Itoa(i), int64(10*i), 0))
+	}
+	host := serveNetInfo(t, peers...)
+	for _, opts := range []Options{
+		{Shuffle: true, ShuffleSeed: 42},
+		{StableOutput: true},
+	} {
+		opts.Hosts = []string{host}
+		opts.TopPeers = 6
+		res, err := SelectTopPeers(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"6", "5", "4", "3", "2", "1"}
+		if got := monikers(res.Peers); slices.Equal(got, want) {
+			t.Errorf("shuffle %v, stable output %v: output kept the rank order %v", opts.Shuffle, opts.StableOutput, got)
+		}
+		if got := rankedMonikers(res.passed); !slices.Equal(got, want) {
+			t.Errorf("shuffle %v, stable output %v: passed peers in order %v, want rank order %v", opts.Shuffle, opts.StableOutput, got, want)
+		}
+		var ranked []string
+		for _, p := range res.Audit().Ranked {
+			ranked = append(ranked, p.Moniker)
+		}
+		if !slices.Equal(ranked, want) {
+			t.Errorf("shuffle %v, stable output %v: audit lists %v, want rank order %v", opts.Shuffle, opts.StableOutput, ranked, want)
+		}
+	}
+}
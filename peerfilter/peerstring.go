@@ -0,0 +1,55 @@
+package peerfilter
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// BuildOpts configures buildPeerString.
+type BuildOpts struct {
+	Scheme     string // prefix of every entry, e.g. "tcp://"
+	MaxEntries int    // keep at most this many entries (0 keeps all)
+}
+
+// buildPeerString renders peers as a comma-separated id@host:port list
+// like formatPeerString, but guarantees a clean result: entries that fail
+// ValidateEntry are skipped, a node ID or address seen before is dropped
+// in favor of its first, best-ranked entry, and at most opts.MaxEntries
+// entries are kept. It fails only if peers were given and none of them
+// yields a valid entry.
+func buildPeerString(peers []peerWithBytes, opts BuildOpts) (string, error) {
+	if opts.MaxEntries < 0 {
+		return "", fmt.Errorf("max entries must not be negative, got %d", opts.MaxEntries)
+	}
+	seenIDs := make(map[string]bool, len(peers))
+	seenAddrs := make(map[string]bool, len(peers))
+	var entries []string
+	invalid := 0
+	for _, p := range peers {
+		if opts.MaxEntries > 0 && len(entries) == opts.MaxEntries {
+			log.Debugf("Capped the peer string at %d of %d peers", opts.MaxEntries, len(peers))
+			break
+		}
+		id := strings.ToLower(p.peer.NodeInfo.DefaultNodeID)
+		entry := peerEntry(p, opts.Scheme)
+		addr, err := ValidateEntry(entry)
+		if err != nil {
+			invalid++
+			log.Warnf("Leaving invalid entry %q out of the peer string: %v", entry, err)
+			continue
+		}
+		addr = strings.ToLower(addr)
+		if seenIDs[id] || seenAddrs[addr] {
+			log.Debugf("Leaving duplicate entry %q out of the peer string", entry)
+			continue
+		}
+		seenIDs[id] = true
+		seenAddrs[addr] = true
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 && invalid > 0 {
+		return "", fmt.Errorf("none of the %d peers has a valid peer string entry", invalid)
+	}
+	return strings.Join(entries, ","), nil
+}
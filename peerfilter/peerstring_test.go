@@ -0,0 +1,65 @@
+package peerfilter
+
+import (
+	"github.com/sirupsen/logrus/hooks/test"
+	"strings"
+	"testing"
+)
+
+func TestBuildPeerString(t *testing.T) {
+	best := testPeer(1, "best", 10, 10)
+	best.NodeInfo.DefaultNodeID = testID("a")
+	// The same node ID in upper case, at another address.
+	sameID := testPeer(7, "same-id", 10, 10)
+	sameID.NodeInfo.DefaultNodeID = testID("A")
+	// Another node at the same address.
+	sameAddr := testPeer(8, "same-addr", 10, 10)
+	sameAddr.NodeInfo.ListenAddr = "tcp://10.0.0.1:26656"
+	badID := testPeer(5, "bad-id", 10, 10)
+	badID.NodeInfo.DefaultNodeID = "xyz"
+	badPort := testPeer(6, "bad-port", 10, 10)
+	badPort.NodeInfo.ListenAddr = "tcp://10.0.0.6:0"
+	peers := parsedPeers(t, best, sameID, badID, sameAddr, testPeer(2, "b", 10, 10), badPort, testPeer(3, "c", 10, 10))
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	entries := []string{
+		"tcp://" + testID("a") + "@10.0.0.1:26656",
+		"tcp://" + testID("2") + "@10.0.0.2:26656",
+		"tcp://" + testID("3") + "@10.0.0.3:26656",
+	}
+	for max, want := range map[int][]string{0: entries, 2: entries[:2], 10: entries} {
+		got, err := buildPeerString(peers, BuildOpts{Scheme: "tcp://", MaxEntries: max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != strings.Join(want, ",") {
+			t.Errorf("max entries %d: peer string %q, want %q", max, got, strings.Join(want, ","))
+		}
+		for _, entry := range strings.Split(got, ",") {
+			if _, err := ValidateEntry(entry); err != nil {
+				t.Errorf("max entries %d: invalid entry %q: %v", max, entry, err)
+			}
+		}
+	}
+	var warned int
+	for _, e := range hook.AllEntries() {
+		if strings.HasPrefix(e.Message, "Leaving invalid entry") {
+			warned++
+		}
+	}
+	// Two in each full build, and only the bad ID before the cap of 2.
+	if warned != 5 {
+		t.Errorf("warned about %d invalid entries over the three builds, want 5", warned)
+	}
+
+	if got, err := buildPeerString(nil, BuildOpts{}); got != "" || err != nil {
+		t.Errorf("buildPeerString(nil) = %q, %v, want an empty string", got, err)
+	}
+	if _, err := buildPeerString(parsedPeers(t, badID, badPort), BuildOpts{}); err == nil {
+		t.Error("buildPeerString with only invalid entries succeeded")
+	}
+	if _, err := buildPeerString(peers, BuildOpts{MaxEntries: -1}); err == nil {
+		t.Error("buildPeerString with negative max entries succeeded")
+	}
+}
@@ -0,0 +1,95 @@
+package peerfilter
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultProbeConcurrency bounds the /health probes run at once.
+const DefaultProbeConcurrency = 8
+
+// probeResult is the outcome of one /health probe.
+type probeResult struct {
+	err error
+	rtt time.Duration // round-trip time of a successful probe
+}
+
+// probeAll calls /health on the advertised RPC address of each peer, at
+// most concurrency at a time, each within timeout. The results are in the
+// order of peers.
+func probeAll(ctx context.Context, peers []peerWithBytes, concurrency int, timeout time.Duration) []probeResult {
+	client := &http.Client{Timeout: timeout}
+	results := make([]probeResult, len(peers))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			results[i].err = probeHealth(ctx, client, p.peer)
+			results[i].rtt = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// probeRPC returns the peers whose /health probe answered 200 OK, in
+// their original order.
+func probeRPC(ctx context.Context, peers []peerWithBytes, concurrency int, timeout time.Duration) []peerWithBytes {
+	var kept []peerWithBytes
+	for i, r := range probeAll(ctx, peers, concurrency, timeout) {
+		if r.err != nil {
+			log.Warnf("Dropping peer %s: RPC health probe failed: %v", peers[i].peer.NodeInfo.DefaultNodeID, r.err)
+			continue
+		}
+		kept = append(kept, peers[i])
+	}
+	return kept
+}
+
+// measureLatency sets the latency of each peer to the round-trip time of
+// its /health probe. Peers whose probe fails get the full timeout, so they
+// rank behind every peer that answered.
+func measureLatency(ctx context.Context, peers []peerWithBytes, concurrency int, timeout time.Duration) {
+	failed := 0
+	for i, r := range probeAll(ctx, peers, concurrency, timeout) {
+		peers[i].latency = r.rtt
+		if r.err != nil {
+			failed++
+			peers[i].latency = timeout
+			log.Debugf("RPC health probe of peer %s failed: %v", peers[i].peer.NodeInfo.DefaultNodeID, r.err)
+		}
+	}
+	if failed > 0 {
+		log.Infof("%d of %d peers did not answer the latency probe and rank last", failed, len(peers))
+	}
+}
+
+// probeHealth requests /health from the RPC address p advertises.
+func probeHealth(ctx context.Context, client *http.Client, p Peer) error {
+	addr, err := rpcAddress(p)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addPrefix(addr+"/health"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	return nil
+}
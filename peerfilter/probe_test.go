@@ -0,0 +1,63 @@
+package peerfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// healthPeer returns testPeer n advertising an RPC stub whose /health
+// answers status after delay.
+func healthPeer(t *testing.T, n int, moniker string, status int, delay time.Duration) Peer {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	p := testPeer(n, moniker, 10, 10)
+	p.NodeInfo.Other.RPCAddress = strings.Replace(srv.URL, "http://", "tcp://", 1)
+	// rpcAddress swaps a loopback host for the remote IP.
+	p.RemoteIP = "127.0.0.1"
+	return p
+}
+
+func TestProbeRPC(t *testing.T) {
+	peers := parsedPeers(t,
+		healthPeer(t, 1, "healthy", http.StatusOK, 0),
+		healthPeer(t, 2, "unhealthy", http.StatusServiceUnavailable, 0),
+	)
+	got := probeRPC(context.Background(), peers, 2, time.Second)
+	if names := strings.Join(rankedMonikers(got), ","); names != "healthy" {
+		t.Errorf("kept %s, want only the healthy peer", names)
+	}
+}
+
+func TestRankLatency(t *testing.T) {
+	// The slowest stub has moved the most bytes, so only latency puts it
+	// last.
+	slow := healthPeer(t, 1, "slow", http.StatusOK, 150*time.Millisecond)
+	slow.ConnectionStatus.SendMonitor.Bytes = "1000"
+	host := serveNetInfo(t, slow,
+		healthPeer(t, 2, "fast", http.StatusOK, 0),
+		healthPeer(t, 3, "medium", http.StatusOK, 50*time.Millisecond),
+	)
+	res, err := SelectTopPeers(context.Background(), Options{
+		Hosts:        []string{host},
+		SortBy:       string(RankLatency),
+		ProbeTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(monikers(res.Peers), ","); got != "fast,medium,slow" {
+		t.Errorf("ranked by latency %s, want fast,medium,slow", got)
+	}
+}
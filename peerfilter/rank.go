@@ -0,0 +1,367 @@
+package peerfilter
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+// RankKey names a value peers can be ranked by.
+type RankKey string
+
+const (
+	RankBytes            RankKey = "bytes"               // bytes sent and received
+	RankRate             RankKey = "rate"                // current send+recv rate
+	RankRecentSent       RankKey = "recent-sent"         // RecentlySent summed over channels, weighted by Options.ChannelWeights
+	RankChannelDiversity RankKey = "channel-diversity"   // distinct advertised channels
+	RankDelta            RankKey = "delta"               // bytes since the previous run, see Deltas
+	RankStability        RankKey = "stability"           // rate stability and send/recv symmetry, see Stability
+	RankWeightedRate     RankKey = "weighted-rate"       // rate history averaged with Stability.Kernel
+	RankLatency          RankKey = "latency"             // lowest RPC /health round-trip time first, see Options.ProbeTimeout
+	RankThroughput       RankKey = "lifetime-throughput" // bytes per second over the connection's lifetime
+	RankBlend            RankKey = "blend"               // normalized bytes and rate, see sortPeers
+	RankSeed             RankKey = "seed"                // normalized channels and recent-sent, see sortPeers
+)
+
+// RankKeys lists every rank key in the order they are documented.
+var RankKeys = []RankKey{RankBytes, RankRate, RankRecentSent, RankChannelDiversity, RankDelta, RankStability, RankWeightedRate, RankLatency, RankThroughput, RankBlend, RankSeed}
+
+// rankValues holds the per-peer value of every key except RankBlend and
+// RankSeed, which depend on the whole peer set.
+var rankValues = map[RankKey]func(p peerWithBytes) float64{
+	RankBytes:            func(p peerWithBytes) float64 { return float64(p.totalBytes) },
+	RankRate:             func(p peerWithBytes) float64 { return float64(p.curRate) },
+	RankRecentSent:       func(p peerWithBytes) float64 { return p.weighted },
+	RankChannelDiversity: func(p peerWithBytes) float64 { return float64(len(p.channels)) },
+	RankDelta:            func(p peerWithBytes) float64 { return float64(p.delta) },
+	RankStability:        func(p peerWithBytes) float64 { return p.stability },
+	RankWeightedRate:     func(p peerWithBytes) float64 { return p.avgRate },
+	RankLatency:          func(p peerWithBytes) float64 { return -p.latency.Seconds() },
+	RankThroughput:       lifetimeThroughput,
+}
+
+// lifetimeThroughput returns the average bytes per second p has moved
+// since it connected, 0 if its duration is unknown.
+func lifetimeThroughput(p peerWithBytes) float64 {
+	if p.duration <= 0 {
+		return 0
+	}
+	return float64(p.totalBytes) / p.duration.Seconds()
+}
+
+// TieBreakKeys lists the secondary keys, in the order they are
+// documented, that order peers whose scores are equal.
+var TieBreakKeys = []string{"node_id", "total_bytes", "moniker", "remote_ip", "duration"}
+
+// tieBreakers reports whether a sorts before b for each of TieBreakKeys:
+// IDs, monikers and IPs ascending, the most bytes and longer-lived
+// connections first.
+var tieBreakers = map[string]func(a, b peerWithBytes) bool{
+	"node_id":     func(a, b peerWithBytes) bool { return a.peer.NodeInfo.DefaultNodeID < b.peer.NodeInfo.DefaultNodeID },
+	"total_bytes": func(a, b peerWithBytes) bool { return a.totalBytes > b.totalBytes },
+	"moniker":     func(a, b peerWithBytes) bool { return a.peer.NodeInfo.Moniker < b.peer.NodeInfo.Moniker },
+	"remote_ip": func(a, b peerWithBytes) bool {
+		ipA, ipB := net.ParseIP(a.peer.RemoteIP).To16(), net.ParseIP(b.peer.RemoteIP).To16()
+		if ipA == nil || ipB == nil {
+			return a.peer.RemoteIP < b.peer.RemoteIP
+		}
+		return bytes.Compare(ipA, ipB) < 0
+	},
+	"duration": func(a, b peerWithBytes) bool { return a.duration > b.duration },
+}
+
+// ParseTieBreak checks that s names one of TieBreakKeys.
+func ParseTieBreak(s string) (string, error) {
+	if _, ok := tieBreakers[s]; !ok {
+		return "", fmt.Errorf("unknown secondary sort key %q, want one of %s", s, strings.Join(TieBreakKeys, ", "))
+	}
+	return s, nil
+}
+
+// ParseRankKey checks that s names a rank key.
+func ParseRankKey(s string) (RankKey, error) {
+	for _, k := range RankKeys {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort key %q", s)
+}
+
+// rankValue returns the value of p for key; higher values rank first.
+// It returns 0 for RankBlend, RankSeed and unknown keys.
+func rankValue(p peerWithBytes, key RankKey) float64 {
+	if value, ok := rankValues[key]; ok {
+		return value(p)
+	}
+	return 0
+}
+
+// sortPeers orders peers in place by key, highest first, breaking ties by
+// tieBreak, one of TieBreakKeys (node_id if empty), and then by node ID,
+// and records each peer's score. For RankBlend, bytes and rate are each
+// normalized to [0,1] over the peer set and combined as
+// blendRatio*bytes + (1-blendRatio)*rate.
+//
+// RankSeed suits seed nodes, which serve many short-lived peers: a peer
+// that speaks many channels and is sending actively right now is more
+// useful to them than one with a large lifetime byte count. Its score is
+// the mean of the distinct channel count and the recently-sent bytes, each
+// normalized to [0,1]; tieBreak total_bytes lets cumulative bytes break
+// its ties.
+func sortPeers(peers []peerWithBytes, key RankKey, blendRatio float64, tieBreak string) error {
+	if tieBreak == "" {
+		tieBreak = "node_id"
+	}
+	less, ok := tieBreakers[tieBreak]
+	if !ok {
+		_, err := ParseTieBreak(tieBreak)
+		return err
+	}
+	score := func(p peerWithBytes) float64 { return rankValue(p, key) }
+	switch key {
+	case RankBlend:
+		normBytes := normalizer(peers, func(p peerWithBytes) float64 { return rankValue(p, RankBytes) })
+		normRate := normalizer(peers, func(p peerWithBytes) float64 { return rankValue(p, RankRate) })
+		score = func(p peerWithBytes) float64 {
+			return blendRatio*normBytes(p) + (1-blendRatio)*normRate(p)
+		}
+	case RankSeed:
+		normChannels := normalizer(peers, func(p peerWithBytes) float64 { return rankValue(p, RankChannelDiversity) })
+		normRecent := normalizer(peers, func(p peerWithBytes) float64 { return rankValue(p, RankRecentSent) })
+		score = func(p peerWithBytes) float64 {
+			return (normChannels(p) + normRecent(p)) / 2
+		}
+	default:
+		if _, err := ParseRankKey(string(key)); err != nil {
+			return err
+		}
+	}
+
+	for i := range peers {
+		peers[i].score = score(peers[i])
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		si, sj := peers[i].score, peers[j].score
+		if si != sj {
+			return si > sj
+		}
+		if less(peers[i], peers[j]) {
+			return true
+		}
+		if less(peers[j], peers[i]) {
+			return false
+		}
+		return peers[i].peer.NodeInfo.DefaultNodeID < peers[j].peer.NodeInfo.DefaultNodeID
+	})
+	return nil
+}
+
+// normalizer returns a function mapping value(p) onto [0,1] using the
+// minimum and maximum of value over peers.
+func normalizer(peers []peerWithBytes, value func(p peerWithBytes) float64) func(p peerWithBytes) float64 {
+	if len(peers) == 0 {
+		return value
+	}
+	lo, hi := value(peers[0]), value(peers[0])
+	for _, p := range peers[1:] {
+		v := value(p)
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	return func(p peerWithBytes) float64 {
+		if hi == lo {
+			return 0
+		}
+		return (value(p) - lo) / (hi - lo)
+	}
+}
+
+// selectBalanced picks n peers from the ranked list, half of them inbound
+// and half outbound, each group in rank order. The inbound peers come
+// first. If one direction has too few peers the other fills the gap.
+func selectBalanced(ranked []peerWithBytes, n int) []peerWithBytes {
+	var inbound, outbound []peerWithBytes
+	for _, p := range ranked {
+		if p.peer.IsOutbound {
+			outbound = append(outbound, p)
+		} else {
+			inbound = append(inbound, p)
+		}
+	}
+
+	wantIn := n / 2
+	wantOut := n - wantIn
+	if len(inbound) < wantIn {
+		wantOut += wantIn - len(inbound)
+		wantIn = len(inbound)
+	}
+	if len(outbound) < wantOut {
+		wantIn += wantOut - len(outbound)
+		wantOut = len(outbound)
+	}
+	wantIn = min(wantIn, len(inbound))
+
+	selected := make([]peerWithBytes, 0, wantIn+wantOut)
+	selected = append(selected, inbound[:wantIn]...)
+	return append(selected, outbound[:wantOut]...)
+}
+
+// selectFleet picks n peers for member index of a fleet of size nodes, so
+// that members spread their connections over the good peers instead of all
+// choosing the same top n. Member i takes ranks i, i+size, i+2*size and so
+// on; if that stripe runs out, the best remaining peers fill the gap. The
+// result is in rank order.
+func selectFleet(ranked []peerWithBytes, n, index, size int) []peerWithBytes {
+	picked := make([]bool, len(ranked))
+	count := 0
+	for i := index; i < len(ranked) && count < n; i += size {
+		picked[i] = true
+		count++
+	}
+	for i := 0; i < len(ranked) && count < n; i++ {
+		if !picked[i] {
+			picked[i] = true
+			count++
+		}
+	}
+
+	selected := make([]peerWithBytes, 0, count)
+	for i, p := range ranked {
+		if picked[i] {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// selectCoverage greedily picks n peers so that together they advertise
+// as many distinct channels as possible: each step takes the peer adding
+// the most channels not yet covered, the better-ranked one on ties. Once
+// no peer adds a channel, the best remaining peers fill the gap. The
+// result is in rank order.
+func selectCoverage(ranked []peerWithBytes, n int) []peerWithBytes {
+	n = min(n, len(ranked))
+	picked := make([]bool, len(ranked))
+	covered := make(map[byte]bool)
+	for count := 0; count < n; count++ {
+		best, bestGain := -1, 0
+		for i, p := range ranked {
+			if picked[i] {
+				continue
+			}
+			gain := 0
+			for _, ch := range p.channels {
+				if !covered[ch] {
+					gain++
+				}
+			}
+			if best < 0 || gain > bestGain {
+				best, bestGain = i, gain
+			}
+		}
+		picked[best] = true
+		for _, ch := range ranked[best].channels {
+			covered[ch] = true
+		}
+	}
+
+	selected := make([]peerWithBytes, 0, n)
+	for i, p := range ranked {
+		if picked[i] {
+			selected = append(selected, p)
+		}
+	}
+	log.Debugf("Selected peers cover %d distinct channels", len(covered))
+	return selected
+}
+
+// capSamePort drops, in rank order, the peers beyond the first limit that
+// share a p2p port, with a warning per port. Many peers listening on one
+// unusual port can be a sign of a scan or a single operator.
+func capSamePort(ranked []peerWithBytes, limit int) []peerWithBytes {
+	counts := make(map[string]int)
+	kept := make([]peerWithBytes, 0, len(ranked))
+	for _, p := range ranked {
+		_, port, err := net.SplitHostPort(p.address)
+		if err != nil {
+			kept = append(kept, p)
+			continue
+		}
+		counts[port]++
+		if counts[port] <= limit {
+			kept = append(kept, p)
+		}
+	}
+	for port, n := range counts {
+		if n > limit {
+			log.Warnf("%d peers listen on port %s; skipping all but the best %d (-max-same-port)", n, port, limit)
+		}
+	}
+	return kept
+}
+
+// selectBudget picks up to n peers whose summed current rates stay within
+// budget bytes/s while covering as many total bytes as possible. It is a
+// knapsack solved greedily, twice: once taking peers by bytes per unit of
+// rate (idle peers with traffic first), which suits a tight budget, and
+// once by bytes alone, which suits a small n. The set covering more bytes
+// wins. The result is in rank order.
+func selectBudget(ranked []peerWithBytes, n int, budget int64) []peerWithBytes {
+	density := func(p peerWithBytes) float64 {
+		switch {
+		case p.totalBytes <= 0:
+			return 0
+		case p.curRate <= 0:
+			return math.Inf(1)
+		}
+		return float64(p.totalBytes) / float64(p.curRate)
+	}
+	byBytes := func(p peerWithBytes) float64 { return float64(p.totalBytes) }
+
+	var picked []bool
+	var used, covered int64
+	for _, key := range []func(p peerWithBytes) float64{density, byBytes} {
+		order := make([]int, len(ranked))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return key(ranked[order[a]]) > key(ranked[order[b]])
+		})
+		try := make([]bool, len(ranked))
+		var tryUsed, tryCovered int64
+		count := 0
+		for _, i := range order {
+			if count >= n {
+				break
+			}
+			if p := ranked[i]; tryUsed+p.curRate <= budget {
+				try[i] = true
+				tryUsed += p.curRate
+				tryCovered += p.totalBytes
+				count++
+			}
+		}
+		if picked == nil || tryCovered > covered {
+			picked, used, covered = try, tryUsed, tryCovered
+		}
+	}
+
+	var selected []peerWithBytes
+	for i, p := range ranked {
+		if picked[i] {
+			selected = append(selected, p)
+		}
+	}
+	log.Debugf("Selected peers use %d of %d bytes/s and cover %d bytes", used, budget, covered)
+	return selected
+}
@@ -0,0 +1,354 @@
+package peerfilter
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus/hooks/test"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rankedMonikers returns the monikers of peers in order.
+func rankedMonikers(peers []peerWithBytes) []string {
+	names := make([]string, 0, len(peers))
+	for _, p := range peers {
+		names = append(names, p.peer.NodeInfo.Moniker)
+	}
+	return names
+}
+
+func TestSortPeersTieBreak(t *testing.T) {
+	// Every peer has the same rate, so -sort-by=rate ties on all of them
+	// and only the secondary key orders them.
+	a := testPeer(1, "carol", 100, 0)
+	a.RemoteIP = "10.0.0.20"
+	a.ConnectionStatus.Duration = "60000000000"
+	b := testPeer(2, "alice", 300, 0)
+	b.RemoteIP = "9.0.0.1"
+	b.ConnectionStatus.Duration = "7200000000000"
+	c := testPeer(3, "bob", 200, 0)
+	c.RemoteIP = "10.0.0.3"
+	c.ConnectionStatus.Duration = "3600000000000"
+
+	for key, want := range map[string][]string{
+		"":            {"carol", "alice", "bob"},
+		"node_id":     {"carol", "alice", "bob"},
+		"total_bytes": {"alice", "bob", "carol"},
+		"moniker":     {"alice", "bob", "carol"},
+		"remote_ip":   {"alice", "bob", "carol"},
+		"duration":    {"alice", "bob", "carol"},
+	} {
+		peers := parsedPeers(t, c, b, a)
+		if err := sortPeers(peers, RankRate, 0, key); err != nil {
+			t.Fatal(err)
+		}
+		if got := rankedMonikers(peers); !slices.Equal(got, want) {
+			t.Errorf("tie break %q: order %v, want %v", key, got, want)
+		}
+	}
+
+	if err := sortPeers(parsedPeers(t, a), RankRate, 0, "bogus"); err == nil {
+		t.Error("sortPeers accepted an unknown tie break")
+	}
+}
+
+func TestSortPeersTieBreakAfterScore(t *testing.T) {
+	// The secondary key only orders equal scores: the higher rate wins
+	// even though its node ID sorts last.
+	low := testPeer(1, "low", 100, 0)
+	high := testPeer(2, "high", 1, 0)
+	high.ConnectionStatus.SendMonitor.CurRate = "900"
+	peers := parsedPeers(t, low, high)
+	if err := sortPeers(peers, RankRate, 0, "node_id"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rankedMonikers(peers); !slices.Equal(got, []string{"high", "low"}) {
+		t.Errorf("order %v, want high before low", got)
+	}
+}
+
+func TestSortPeersChannelDiversity(t *testing.T) {
+	narrow := testPeer(1, "narrow", 9000, 9000)
+	narrow.NodeInfo.Channels = "4040"
+	diverse := testPeer(2, "diverse", 10, 10)
+	diverse.NodeInfo.Channels = "40202122233038"
+	peers := parsedPeers(t, narrow, diverse)
+	if err := sortPeers(peers, RankChannelDiversity, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := rankedMonikers(peers); !slices.Equal(got, []string{"diverse", "narrow"}) {
+		t.Errorf("order %v, want the diverse peer first", got)
+	}
+	if peers[0].score != 7 || peers[1].score != 1 {
+		t.Errorf("scores %g and %g, want 7 and 1 distinct channels", peers[0].score, peers[1].score)
+	}
+}
+
+func TestSelectBalanced(t *testing.T) {
+	var peers []Peer
+	for i, name := range []string{"in1", "in2", "in3", "out1", "in4", "out2"} {
+		p := testPeer(i, name, int64(100-i), 0)
+		p.IsOutbound = strings.HasPrefix(name, "out")
+		peers = append(peers, p)
+	}
+	ranked := parsedPeers(t, peers...)
+	for n, want := range map[int][]string{
+		4: {"in1", "in2", "out1", "out2"},
+		// Only two peers are outbound, so inbound ones fill the gap.
+		5: {"in1", "in2", "in3", "out1", "out2"},
+		6: {"in1", "in2", "in3", "in4", "out1", "out2"},
+	} {
+		if got := rankedMonikers(selectBalanced(ranked, n)); !slices.Equal(got, want) {
+			t.Errorf("selectBalanced(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestRankValue(t *testing.T) {
+	p := peerWithBytes{
+		totalBytes: 7200,
+		curRate:    300,
+		weighted:   42.5,
+		channels:   []byte{0x20, 0x40, 0x60},
+		delta:      900,
+		stability:  0.75,
+		avgRate:    250,
+		latency:    20 * time.Millisecond,
+		duration:   time.Hour,
+	}
+	for key, want := range map[RankKey]float64{
+		RankBytes:            7200,
+		RankRate:             300,
+		RankRecentSent:       42.5,
+		RankChannelDiversity: 3,
+		RankDelta:            900,
+		RankStability:        0.75,
+		RankWeightedRate:     250,
+		RankLatency:          -0.02,
+		RankThroughput:       2,
+		RankBlend:            0,
+		RankSeed:             0,
+		"bogus":              0,
+	} {
+		if got := rankValue(p, key); got != want {
+			t.Errorf("rankValue(%s) = %g, want %g", key, got, want)
+		}
+	}
+	if len(rankValues)+2 != len(RankKeys) {
+		t.Errorf("%d rank values for %d rank keys, want all but blend and seed", len(rankValues), len(RankKeys))
+	}
+}
+
+func TestSelectFleet(t *testing.T) {
+	var peers []Peer
+	for i := 1; i <= 7; i++ {
+		peers = append(peers, testPeer(i, strconv.Itoa(i), 0, 0))
+	}
+	ranked := parsedPeers(t, peers...)
+	for index, want := range [][]string{
+		{"1", "4", "7"},
+		// The stripe runs out after two peers; the best remaining fills in.
+		{"1", "2", "5"},
+		{"1", "3", "6"},
+	} {
+		if got := rankedMonikers(selectFleet(ranked, 3, index, 3)); !slices.Equal(got, want) {
+			t.Errorf("fleet index %d selected %v, want %v", index, got, want)
+		}
+	}
+	if a, b := rankedMonikers(selectFleet(ranked, 3, 0, 2)), rankedMonikers(selectFleet(ranked, 3, 1, 2)); slices.Equal(a, b) {
+		t.Errorf("fleet indices 0 and 1 both selected %v", a)
+	}
+}
+
+func TestSortPeersSeed(t *testing.T) {
+	// The archive node has moved the most bytes but speaks few channels
+	// and is quiet now; the busy one serves many channels right now.
+	archive := testPeer(1, "archive", 90000, 90000)
+	archive.NodeInfo.Channels = "40"
+	archive.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x40, RecentlySent: "5"}}
+	busy := testPeer(2, "busy", 100, 100)
+	busy.NodeInfo.Channels = "2021223038"
+	busy.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x20, RecentlySent: "800"}, {ID: 0x30, RecentlySent: "400"}}
+	middle := testPeer(3, "middle", 5000, 5000)
+	middle.NodeInfo.Channels = "402030"
+	middle.ConnectionStatus.Channels = []ChannelStatus{{ID: 0x40, RecentlySent: "300"}}
+
+	order := func(key RankKey) []string {
+		peers := parsedPeers(t, archive, busy, middle)
+		if err := sortPeers(peers, key, 0, "total_bytes"); err != nil {
+			t.Fatal(err)
+		}
+		return rankedMonikers(peers)
+	}
+	if got, want := order(RankBytes), []string{"archive", "middle", "busy"}; !slices.Equal(got, want) {
+		t.Errorf("bytes order %v, want %v", got, want)
+	}
+	if got, want := order(RankSeed), []string{"busy", "middle", "archive"}; !slices.Equal(got, want) {
+		t.Errorf("seed order %v, want %v", got, want)
+	}
+}
+
+func TestSelectCoverage(t *testing.T) {
+	// The two best-ranked peers speak the same channels; a lower-ranked
+	// one adds new ones.
+	specs := []struct {
+		name, channels string
+	}{
+		{"a", "2021"},
+		{"b", "2021"},
+		{"c", "3038"},
+		{"d", "20"},
+	}
+	var peers []Peer
+	for i, s := range specs {
+		p := testPeer(i+1, s.name, int64(100-i), 0)
+		p.NodeInfo.Channels = HexBytes(s.channels)
+		peers = append(peers, p)
+	}
+	ranked := parsedPeers(t, peers...)
+	covered := func(selected []peerWithBytes) int {
+		channels := make(map[byte]bool)
+		for _, p := range selected {
+			for _, c := range p.channels {
+				channels[c] = true
+			}
+		}
+		return len(channels)
+	}
+
+	got := selectCoverage(ranked, 2)
+	if names := rankedMonikers(got); !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("selectCoverage picked %v, want a and c", names)
+	}
+	if c, top := covered(got), covered(ranked[:2]); c <= top {
+		t.Errorf("coverage selection spans %d channels, the plain top 2 %d; want more", c, top)
+	}
+	// Once no peer adds a channel, rank fills the rest.
+	if names := rankedMonikers(selectCoverage(ranked, 3)); !slices.Equal(names, []string{"a", "b", "c"}) {
+		t.Errorf("selectCoverage(3) picked %v, want a, b and c", names)
+	}
+}
+
+func TestCapSamePort(t *testing.T) {
+	var peers []Peer
+	for i := 1; i <= 6; i++ {
+		p := testPeer(i, strconv.Itoa(i), 0, 0)
+		if i == 3 || i == 5 {
+			p.NodeInfo.ListenAddr = fmt.Sprintf("tcp://10.0.0.%d:26656", i)
+		} else {
+			p.NodeInfo.ListenAddr = fmt.Sprintf("tcp://10.0.0.%d:31337", i)
+		}
+		peers = append(peers, p)
+	}
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	got := rankedMonikers(capSamePort(parsedPeers(t, peers...), 2))
+	if want := []string{"1", "2", "3", "5"}; !slices.Equal(got, want) {
+		t.Errorf("capSamePort kept %v, want %v", got, want)
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "4 peers listen on port 31337") {
+		t.Errorf("last log entry %v, want a warning about port 31337", e)
+	}
+}
+
+func TestSelectBudget(t *testing.T) {
+	ranked := parsedPeers(t, testPeer(1, "a", 0, 0), testPeer(2, "b", 0, 0), testPeer(3, "c", 0, 0), testPeer(4, "d", 0, 0))
+	for i, v := range []struct{ bytes, rate int64 }{{1000, 100}, {600, 50}, {600, 50}, {50, 0}} {
+		ranked[i].totalBytes, ranked[i].curRate = v.bytes, v.rate
+	}
+	usage := func(peers []peerWithBytes) (rate, bytes int64) {
+		for _, p := range peers {
+			rate += p.curRate
+			bytes += p.totalBytes
+		}
+		return rate, bytes
+	}
+
+	for _, tc := range []struct {
+		n      int
+		budget int64
+		want   []string
+	}{
+		// The best set within 100 bytes/s skips the top peer for the two
+		// cheaper ones and the idle one.
+		{4, 100, []string{"b", "c", "d"}},
+		// With a single slot the top peer covers the most on its own.
+		{1, 100, []string{"a"}},
+		{4, 40, []string{"d"}},
+	} {
+		got := selectBudget(ranked, tc.n, tc.budget)
+		if names := rankedMonikers(got); !slices.Equal(names, tc.want) {
+			t.Errorf("selectBudget(%d, %d) picked %v, want %v", tc.n, tc.budget, names, tc.want)
+		}
+		rate, bytes := usage(got)
+		if rate > tc.budget {
+			t.Errorf("selectBudget(%d, %d) uses %d bytes/s", tc.n, tc.budget, rate)
+		}
+		// No subset of at most n peers within budget covers more.
+		for mask := range 1 << len(ranked) {
+			var subset []peerWithBytes
+			for i := range ranked {
+				if mask&(1<<i) != 0 {
+					subset = append(subset, ranked[i])
+				}
+			}
+			if r, b := usage(subset); len(subset) <= tc.n && r <= tc.budget && b > bytes {
+				t.Errorf("selectBudget(%d, %d) covers %d bytes, %v covers %d", tc.n, tc.budget, bytes, rankedMonikers(subset), b)
+			}
+		}
+	}
+}
+
+func TestRankLifetimeThroughput(t *testing.T) {
+	// 100 MB over a day against 10 MB over a minute.
+	long := testPeer(1, "long", 50_000_000, 50_000_000)
+	long.ConnectionStatus.Duration = "86400000000000"
+	short := testPeer(2, "short", 5_000_000, 5_000_000)
+	short.ConnectionStatus.Duration = "60000000000"
+	unknown := testPeer(3, "unknown", 1, 1)
+	unknown.ConnectionStatus.Duration = "0"
+	peers := parsedPeers(t, long, short, unknown)
+
+	if err := sortPeers(peers, RankBytes, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := rankedMonikers(peers)[0]; got != "long" {
+		t.Fatalf("ranked first by bytes: %s, want long", got)
+	}
+	if err := sortPeers(peers, RankThroughput, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rankedMonikers(peers), []string{"short", "long", "unknown"}; !slices.Equal(got, want) {
+		t.Errorf("ranked by lifetime throughput %v, want %v", got, want)
+	}
+}
+
+func TestSortPeersBlendRatio(t *testing.T) {
+	heavy := testPeer(1, "heavy", 0, 0) // many bytes, slow now
+	fast := testPeer(2, "fast", 0, 0)   // few bytes, fast now
+	peers := parsedPeers(t, heavy, fast)
+	peers[0].totalBytes, peers[0].curRate = 10_000, 10
+	peers[1].totalBytes, peers[1].curRate = 100, 1000
+
+	for _, tc := range []struct {
+		ratio float64
+		want  []string
+	}{
+		{0, []string{"fast", "heavy"}},
+		{0.25, []string{"fast", "heavy"}},
+		{0.75, []string{"heavy", "fast"}},
+		{1, []string{"heavy", "fast"}},
+	} {
+		if err := sortPeers(peers, RankBlend, tc.ratio, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := rankedMonikers(peers); !slices.Equal(got, tc.want) {
+			t.Errorf("blend ratio %g: order %v, want %v", tc.ratio, got, tc.want)
+		}
+		if top := peers[0].score; top != max(tc.ratio, 1-tc.ratio) {
+			t.Errorf("blend ratio %g: top score %g, want %g", tc.ratio, top, max(tc.ratio, 1-tc.ratio))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package peerfilter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// redactors maps each field name accepted by Options.Redact, named as in
+// the JSON and CSV output, to a function blanking it.
+var redactors = map[string]func(p *peerWithBytes){
+	"node_id":      func(p *peerWithBytes) { p.peer.NodeInfo.DefaultNodeID = "" },
+	"address":      func(p *peerWithBytes) { p.address = ""; p.peer.NodeInfo.ListenAddr = "" },
+	"remote_ip":    func(p *peerWithBytes) { p.peer.RemoteIP = "" },
+	"moniker":      func(p *peerWithBytes) { p.peer.NodeInfo.Moniker = "" },
+	"network":      func(p *peerWithBytes) { p.peer.NodeInfo.Network = "" },
+	"version":      func(p *peerWithBytes) { p.peer.NodeInfo.Version = "" },
+	"asn":          func(p *peerWithBytes) { p.asn = 0 },
+	"as_org":       func(p *peerWithBytes) { p.asOrg = "" },
+	"source_hosts": func(p *peerWithBytes) { p.sources = nil },
+}
+
+// checkRedactFields reports an unknown field name in fields.
+func checkRedactFields(fields []string) error {
+	for _, f := range fields {
+		if _, ok := redactors[f]; !ok {
+			known := make([]string, 0, len(redactors))
+			for name := range redactors {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown redact field %q, want one of %v", f, known)
+		}
+	}
+	return nil
+}
+
+// redact blanks fields in every peer, in place.
+func redact(peers []peerWithBytes, fields []string) {
+	for i := range peers {
+		for _, f := range fields {
+			redactors[f](&peers[i])
+		}
+	}
+}
+
+// scrub returns peers as r may show them outside the formatted output: a
+// copy anonymized as with Options.Anonymize and with the fields of
+// Options.Redact blanked. The metrics and the audit, which list peers
+// beyond the selected ones, go through it. The selected peers have
+// already been scrubbed.
+func (r *Result) scrub(peers []peerWithBytes) []peerWithBytes {
+	if r.anon != nil {
+		peers = r.anon.apply(peers)
+	}
+	if len(r.redact) == 0 {
+		return peers
+	}
+	peers = slices.Clone(peers)
+	redact(peers, r.redact)
+	return peers
+}
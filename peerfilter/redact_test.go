@@ -0,0 +1,82 @@
+package peerfilter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// gaugeLabels returns the label sets of the series of the named metric
+// in Registry.
+func gaugeLabels(t *testing.T, name string) []map[string]string {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []map[string]string
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			series = append(series, labels)
+		}
+	}
+	return series
+}
+
+func TestRedactJSON(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "alpha", 10, 10), testPeer(2, "beta", 5, 5))
+	opts := Options{Hosts: []string{host}, OutputFormat: "json", Redact: []string{"moniker", "remote_ip"}}
+	res, err := SelectTopPeers(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Format(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []PeerRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	for _, r := range records {
+		if r.Moniker != "" || r.RemoteIP != "" {
+			t.Errorf("record %s has moniker %q and remote_ip %q, want both redacted", r.NodeID, r.Moniker, r.RemoteIP)
+		}
+		if r.NodeID == "" || r.Address == "" {
+			t.Errorf("record %+v lost a field that was not redacted", r)
+		}
+	}
+}
+
+func TestRedactMetricsAndAudit(t *testing.T) {
+	host := serveNetInfo(t, testPeer(1, "alpha", 10, 10), testPeer(2, "beta", 5, 5), testPeer(3, "gamma", 1, 1))
+	res, err := SelectTopPeers(context.Background(), Options{Hosts: []string{host}, TopPeers: 1, Redact: []string{"moniker"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RecordMetrics(res, false)
+	series := gaugeLabels(t, "peer_filter_peer_bytes")
+	if len(series) == 0 {
+		t.Fatal("no peer_filter_peer_bytes series")
+	}
+	for _, labels := range series {
+		if labels["moniker"] != "" {
+			t.Errorf("peer_filter_peer_bytes has moniker label %q, want it redacted", labels["moniker"])
+		}
+	}
+	for _, p := range res.Audit().Ranked {
+		if p.Moniker != "" {
+			t.Errorf("audit lists peer %s with moniker %q, want it redacted", p.NodeID, p.Moniker)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package peerfilter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SLA flags selected peers whose current rate stays below MinRate or whose
+// idle time exceeds MaxIdle for Intervals consecutive runs (at least one).
+// A zero threshold is not checked.
+type SLA struct {
+	MinRate   int64         `json:"min_rate"` // bytes per second, send plus receive
+	MaxIdle   time.Duration `json:"max_idle"`
+	Intervals int           `json:"intervals"`
+
+	violations map[string]int // consecutive violating runs per node ID
+}
+
+// SLAAlert reports a peer that has violated the SLA for the configured
+// number of runs.
+type SLAAlert struct {
+	NodeID    string `json:"node_id"`
+	Moniker   string `json:"moniker"`
+	Address   string `json:"address"`
+	Reason    string `json:"reason"`
+	Intervals int    `json:"intervals"`
+}
+
+// check records the violations of peers and returns an alert for each
+// peer that has just reached the configured number of runs. Peers that
+// comply or are no longer selected start over.
+func (s *SLA) check(peers []peerWithBytes) []SLAAlert {
+	need := max(s.Intervals, 1)
+	violations := make(map[string]int)
+	var alerts []SLAAlert
+	for _, p := range peers {
+		var reasons []string
+		if s.MinRate > 0 && p.curRate < s.MinRate {
+			reasons = append(reasons, fmt.Sprintf("rate %d B/s below %d B/s", p.curRate, s.MinRate))
+		}
+		if s.MaxIdle > 0 && p.idle > s.MaxIdle {
+			reasons = append(reasons, fmt.Sprintf("idle %s above %s", p.idle, s.MaxIdle))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		id := p.peer.NodeInfo.DefaultNodeID
+		violations[id] = s.violations[id] + 1
+		if violations[id] == need {
+			alerts = append(alerts, SLAAlert{
+				NodeID:    id,
+				Moniker:   p.peer.NodeInfo.Moniker,
+				Address:   p.address,
+				Reason:    strings.Join(reasons, ", "),
+				Intervals: need,
+			})
+		}
+	}
+	s.violations = violations
+	return alerts
+}
@@ -0,0 +1,67 @@
+package peerfilter
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSLACheck(t *testing.T) {
+	s := &SLA{MinRate: 150, MaxIdle: 5 * time.Second, Intervals: 2}
+	type state struct {
+		rate int64
+		idle time.Duration
+	}
+	ok, slow, idle := state{200, time.Second}, state{100, time.Second}, state{200, time.Minute}
+	for i, run := range []struct {
+		peers map[string]state // selected peers by moniker
+		want  []string         // "moniker: reason" of each alert
+	}{
+		{map[string]state{"a": slow, "b": ok}, nil},
+		// a violates for the second run in a row.
+		{map[string]state{"a": slow, "b": idle}, []string{"a: rate 100 B/s below 150 B/s"}},
+		// a has already been reported; b reaches 2 runs.
+		{map[string]state{"a": slow, "b": idle}, []string{"b: idle 1m0s above 5s"}},
+		// a recovers, b keeps violating past the threshold.
+		{map[string]state{"a": ok, "b": {100, time.Minute}}, nil},
+		// a starts over, b is no longer selected.
+		{map[string]state{"a": slow}, nil},
+		{map[string]state{"a": slow, "b": slow}, []string{"a: rate 100 B/s below 150 B/s"}},
+	} {
+		var peers []peerWithBytes
+		for _, name := range []string{"a", "b"} {
+			st, selected := run.peers[name]
+			if !selected {
+				continue
+			}
+			p := parsedPeers(t, testPeer(len(peers)+1, name, 0, 0))[0]
+			p.peer.NodeInfo.DefaultNodeID = testID(name)
+			p.curRate, p.idle = st.rate, st.idle
+			peers = append(peers, p)
+		}
+		var got []string
+		for _, a := range s.check(peers) {
+			if a.NodeID != testID(a.Moniker) || a.Intervals != 2 {
+				t.Errorf("run %d: alert %+v, want the peer's node ID and 2 intervals", i+1, a)
+			}
+			got = append(got, a.Moniker+": "+a.Reason)
+		}
+		if !slices.Equal(got, run.want) {
+			t.Errorf("run %d: alerts %q, want %q", i+1, got, run.want)
+		}
+	}
+}
+
+func TestSLACheckBothReasons(t *testing.T) {
+	// Intervals below one alert on the first violating run.
+	s := &SLA{MinRate: 150, MaxIdle: 5 * time.Second}
+	p := parsedPeers(t, testPeer(1, "a", 0, 0))
+	p[0].curRate, p[0].idle = 100, time.Minute
+	alerts := s.check(p)
+	if len(alerts) != 1 || alerts[0].Reason != "rate 100 B/s below 150 B/s, idle 1m0s above 5s" || alerts[0].Intervals != 1 {
+		t.Errorf("alerts %+v, want one for both reasons after 1 run", alerts)
+	}
+	if alerts := s.check(p); len(alerts) != 0 {
+		t.Errorf("second violating run alerted again: %+v", alerts)
+	}
+}
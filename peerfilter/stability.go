@@ -0,0 +1,97 @@
+package peerfilter
+
+import "math"
+
+// Stability keeps each peer's send and receive rates over the last Window
+// runs (at least two) to score connection quality for RankStability and
+// draw Options.Sparklines. The
+// score is the mean of two values in [0,1]:
+//
+//   - stability, 1/(1+cv) where cv is the coefficient of variation of the
+//     total rate over the window, so a steady rate scores near 1 and a
+//     jittery one near 0;
+//   - symmetry, the smaller of the summed send and receive rates divided
+//     by the larger, so one-way traffic scores 0.
+//
+// Peers with fewer than two samples, or no traffic, score 0. For
+// RankWeightedRate the history is also averaged with Kernel, uniform if
+// nil.
+type Stability struct {
+	Window int        `json:"window"`
+	Kernel RateKernel `json:"-"`
+
+	history map[string][]rateSample
+}
+
+type rateSample struct {
+	send, recv int64
+}
+
+// apply records the current rates of each peer and sets its stability
+// score and rate history. Peers that are gone are forgotten.
+func (s *Stability) apply(peers []peerWithBytes) {
+	window := max(s.Window, 2)
+	next := make(map[string][]rateSample, len(peers))
+	for i := range peers {
+		p := &peers[i]
+		id := p.peer.NodeInfo.DefaultNodeID
+		samples := append(s.history[id], rateSample{send: p.sendRate, recv: p.curRate - p.sendRate})
+		if len(samples) > window {
+			samples = samples[len(samples)-window:]
+		}
+		next[id] = samples
+		p.stability = stabilityScore(samples)
+		p.rates = make([]int64, len(samples))
+		for j, r := range samples {
+			p.rates[j] = r.send + r.recv
+		}
+		p.avgRate = weightedRate(p.rates, s.Kernel)
+	}
+	s.history = next
+}
+
+// stabilityScore scores a rate history as described on Stability.
+func stabilityScore(samples []rateSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	var sum, sendSum, recvSum float64
+	for _, r := range samples {
+		sendSum += float64(r.send)
+		recvSum += float64(r.recv)
+	}
+	sum = sendSum + recvSum
+	if sum == 0 {
+		return 0
+	}
+	mean := sum / float64(len(samples))
+	var variance float64
+	for _, r := range samples {
+		d := float64(r.send+r.recv) - mean
+		variance += d * d
+	}
+	cv := math.Sqrt(variance/float64(len(samples))) / mean
+	symmetry := math.Min(sendSum, recvSum) / math.Max(sendSum, recvSum)
+	return (1/(1+cv) + symmetry) / 2
+}
+
+// sparkRamp holds the sparkline levels, lowest first.
+const sparkRamp = " .:-=+*#"
+
+// sparkline draws values as one ASCII character each, scaled so the
+// largest maps to the top of sparkRamp and zero to the bottom.
+func sparkline(values []int64) string {
+	var hi int64
+	for _, v := range values {
+		hi = max(hi, v)
+	}
+	out := make([]byte, len(values))
+	for i, v := range values {
+		level := 0
+		if hi > 0 && v > 0 {
+			level = int(float64(v) / float64(hi) * float64(len(sparkRamp)-1))
+		}
+		out[i] = sparkRamp[level]
+	}
+	return string(out)
+}
@@ -0,0 +1,63 @@
+package peerfilter
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStabilityRanking(t *testing.T) {
+	stable, jittery := []int64{100, 100, 110, 100, 90}, []int64{10, 500, 20, 600, 900}
+	s := &Stability{Window: len(stable)}
+	var peers []peerWithBytes
+	for i := range stable {
+		peers = parsedPeers(t, testPeer(1, "stable", 0, 0), testPeer(2, "jittery", 0, 0))
+		for j, rate := range []int64{stable[i], jittery[i]} {
+			peers[j].sendRate = rate
+			peers[j].curRate = 2 * rate
+		}
+		s.apply(peers)
+	}
+	if peers[0].stability <= peers[1].stability {
+		t.Errorf("stable score %g, jittery %g, want the stable one higher", peers[0].stability, peers[1].stability)
+	}
+	if want := []int64{200, 200, 220, 200, 180}; !slices.Equal(peers[0].rates, want) {
+		t.Errorf("stable rate history %v, want %v", peers[0].rates, want)
+	}
+	// The jittery peer has the higher current rate but ranks second.
+	if err := sortPeers(peers, RankStability, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rankedMonikers(peers), []string{"stable", "jittery"}; !slices.Equal(got, want) {
+		t.Errorf("ranked by stability %v, want %v", got, want)
+	}
+}
+
+func TestStabilityScore(t *testing.T) {
+	steady := []rateSample{{50, 50}, {50, 50}, {50, 50}}
+	if got := stabilityScore(steady); got != 1 {
+		t.Errorf("steady symmetric score %g, want 1", got)
+	}
+	oneWay := []rateSample{{100, 0}, {100, 0}}
+	if got := stabilityScore(oneWay); got != 0.5 {
+		t.Errorf("steady one-way score %g, want 0.5", got)
+	}
+	if got := stabilityScore(steady[:1]); got != 0 {
+		t.Errorf("single sample score %g, want 0", got)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	for _, tc := range []struct {
+		values []int64
+		want   string
+	}{
+		{nil, ""},
+		{[]int64{0, 0}, "  "},
+		{[]int64{0, 1, 2, 3, 4, 5, 6, 7}, " .:-=+*#"},
+		{[]int64{700, 350, 100, 0}, "#-. "},
+	} {
+		if got := sparkline(tc.values); got != tc.want {
+			t.Errorf("sparkline(%v) = %q, want %q", tc.values, got, tc.want)
+		}
+	}
+}
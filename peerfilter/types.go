@@ -0,0 +1,131 @@
+package peerfilter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// Status represents transfer status (embedded in ConnectionStatus).
+// CometBFT encodes these fields with their Go names, so the tags spell
+// them out explicitly.
+type Status struct {
+	Start    time.Time `json:"Start"` // Transfer start time
+	Bytes    string    `json:"Bytes"`
+	Samples  string    `json:"Samples"`
+	InstRate string    `json:"InstRate"`
+	CurRate  string    `json:"CurRate"`
+	AvgRate  string    `json:"AvgRate"`
+	PeakRate string    `json:"PeakRate"`
+	BytesRem string    `json:"BytesRem"`
+	Duration string    `json:"Duration"`
+	Idle     string    `json:"Idle"`
+	TimeRem  string    `json:"TimeRem"`
+	Progress Percent   `json:"Progress"`
+	Active   bool      `json:"Active"`
+}
+
+type Percent uint32
+
+// CometBFTNetInfoResult and related types (for unmarshaling net_info)
+type CometBFTNetInfoResult struct {
+	Result  ResultNetInfo `json:"result"`
+	ID      any           `json:"id"`
+	Jsonrpc string        `json:"jsonrpc"`
+}
+
+type ResultNetInfo struct {
+	Listening bool     `json:"listening"`
+	Listeners []string `json:"listeners"`
+	NPeers    string   `json:"n_peers"`
+	Peers     []Peer   `json:"peers"`
+}
+
+type Peer struct {
+	NodeInfo         DefaultNodeInfo  `json:"node_info"`
+	IsOutbound       bool             `json:"is_outbound"`
+	ConnectionStatus ConnectionStatus `json:"connection_status"`
+	RemoteIP         string           `json:"remote_ip"`
+}
+
+type ConnectionStatus struct {
+	Duration    string          `json:"Duration"`
+	SendMonitor Status          `json:"SendMonitor"`
+	RecvMonitor Status          `json:"RecvMonitor"`
+	Channels    []ChannelStatus `json:"Channels"`
+}
+
+type ChannelStatus struct {
+	ID                byte   `json:"ID"`
+	SendQueueCapacity string `json:"SendQueueCapacity"`
+	SendQueueSize     string `json:"SendQueueSize"`
+	Priority          string `json:"Priority"`
+	RecentlySent      string `json:"RecentlySent"`
+}
+
+type DefaultNodeInfo struct {
+	ProtocolVersion ProtocolVersion      `json:"protocol_version"`
+	DefaultNodeID   string               `json:"id"`
+	ListenAddr      string               `json:"listen_addr"`
+	Network         string               `json:"network"`
+	Version         string               `json:"version"`
+	Channels        HexBytes             `json:"channels"`
+	Moniker         string               `json:"moniker"`
+	Other           DefaultNodeInfoOther `json:"other"`
+}
+
+type ProtocolVersion struct {
+	P2P   string `json:"p2p"`
+	Block string `json:"block"`
+	App   string `json:"app"`
+}
+
+type HexBytes string
+
+// Decode returns the bytes encoded by the hex string. Some forks encode
+// the bytes in base64 instead, so when hex decoding fails the string is
+// decoded as padded or unpadded standard base64.
+func (b HexBytes) Decode() ([]byte, error) {
+	decoded, err := hex.DecodeString(string(b))
+	if err == nil {
+		return decoded, nil
+	}
+	if decoded, b64Err := base64.StdEncoding.DecodeString(string(b)); b64Err == nil {
+		return decoded, nil
+	}
+	if decoded, b64Err := base64.RawStdEncoding.DecodeString(string(b)); b64Err == nil {
+		return decoded, nil
+	}
+	return nil, err
+}
+
+type DefaultNodeInfoOther struct {
+	TxIndex    string `json:"tx_index"`
+	RPCAddress string `json:"rpc_address"`
+}
+
+// peerWithBytes pairs a peer with its total transferred bytes.
+type peerWithBytes struct {
+	peer       Peer
+	totalBytes int64
+	curRate    int64
+	sendRate   int64         // send part of curRate
+	recentSent int64         // RecentlySent summed over all channels
+	weighted   float64       // RecentlySent summed with Options.ChannelWeights
+	samples    int64         // monitor samples, send plus receive
+	delta      int64         // bytes since the previous run, see Deltas
+	stability  float64       // rate stability and symmetry score, see Stability
+	rates      []int64       // recent send+recv rates, oldest first, see Stability
+	avgRate    float64       // rates averaged with Stability.Kernel
+	duration   time.Duration // how long the connection has been up
+	idle       time.Duration // time since the last transfer in either direction
+	channels   []byte        // distinct channel IDs advertised in node info
+	address    string        // resolved host:port to dial
+	remotePort string        // port reported in remote_ip, if any
+	latency    time.Duration // RPC /health round-trip time, see RankLatency
+	asn        uint          // autonomous system number, see Options.ASNDatabase
+	asOrg      string        // organization owning asn
+	sources    []string      // hosts (or files) that reported the peer
+	rank       int           // 1-based position after sorting
+	score      float64       // value ranked by, see sortPeers
+}
@@ -0,0 +1,23 @@
+package peerfilter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHexBytesDecode(t *testing.T) {
+	for s, want := range map[HexBytes][]byte{
+		"402021": {0x40, 0x20, 0x21},
+		"QCAh":   {0x40, 0x20, 0x21},
+		"QCA=":   {0x40, 0x20},
+		"QCA":    {0x40, 0x20},
+	} {
+		got, err := s.Decode()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Decode(%q) = %x, %v, want %x", s, got, err, want)
+		}
+	}
+	if _, err := HexBytes("not channels!").Decode(); err == nil {
+		t.Error("Decode accepted a string that is neither hex nor base64")
+	}
+}
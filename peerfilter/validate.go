@@ -0,0 +1,68 @@
+package peerfilter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// nodeIDLength is the length of a hex-encoded CometBFT node ID.
+const nodeIDLength = 40
+
+// ParseEntries splits output written in the peerstring, commented,
+// systemd-env or tfvars format into its id@host:port entries. Comment
+// lines, a leading VAR= assignment and quotes around its value are
+// skipped.
+func ParseEntries(text string) []string {
+	var entries []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(key, "@:/") {
+			line = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// ValidateEntry checks that entry has the form [scheme://]id@host:port
+// with a 40-character hex node ID and a dialable address. It returns the
+// host:port part.
+func ValidateEntry(entry string) (string, error) {
+	if i := strings.Index(entry, "://"); i >= 0 {
+		entry = entry[i+3:]
+	}
+	id, addr, ok := strings.Cut(entry, "@")
+	if !ok {
+		return "", fmt.Errorf("missing @ between node ID and address")
+	}
+	if len(id) != nodeIDLength {
+		return "", fmt.Errorf("node ID %q has %d characters, want %d", id, len(id), nodeIDLength)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", fmt.Errorf("node ID %q is not hex", id)
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "" {
+		return "", fmt.Errorf("address %q has no host", addr)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return "", fmt.Errorf("address %q is unspecified", addr)
+	}
+	if port, err := strconv.Atoi(portStr); err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("address %q has invalid port %q", addr, portStr)
+	}
+	return addr, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// historyPath returns the name of the n-th previous version of path, e.g.
+// peers.2.txt for peers.txt.
+func historyPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// rotateOutput shifts path and its previous versions up by one, keeping at
+// most keep of them: peers.txt becomes peers.1.txt, peers.1.txt becomes
+// peers.2.txt and so on, and the oldest beyond keep is overwritten. Missing
+// versions are skipped.
+func rotateOutput(path string, keep int) error {
+	for n := keep; n >= 1; n-- {
+		from := path
+		if n > 1 {
+			from = historyPath(path, n-1)
+		}
+		err := os.Rename(from, historyPath(path, n))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error rotating %s: %w", from, err)
+		}
+	}
+	return nil
+}
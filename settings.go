@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// applySettingsDir sets each flag that was not given on the command line
+// from a file of the same name in dir, as produced by mounting a
+// Kubernetes ConfigMap as a volume. For example dir/host holds the value
+// of -host. Command-line flags take precedence over files, and files over
+// the built-in defaults.
+func applySettingsDir(fset *flag.FlagSet, dir string) error {
+	explicit := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var errs []error
+	fset.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "settings-dir" {
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading setting %s: %w", f.Name, err))
+			return
+		}
+		if err := fset.Set(f.Name, strings.TrimSpace(string(data))); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s from %s: %w", f.Name, dir, err))
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeSettings writes each setting to a file named after it in dir.
+func writeSettings(t *testing.T, dir string, settings map[string]string) {
+	t.Helper()
+	for name, value := range settings {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApplySettingsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeSettings(t, dir, map[string]string{
+		"host":    "node-a:26657,node-b:26657\n",
+		"top":     "7\n",
+		"timeout": "3s",
+	})
+	o, err := parseFlags([]string{"-settings-dir", dir, "-top", "12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"node-a:26657", "node-b:26657"}; !slices.Equal(o.Hosts, want) {
+		t.Errorf("hosts = %v, want %v from the settings directory", o.Hosts, want)
+	}
+	if o.Timeout != 3*time.Second {
+		t.Errorf("timeout = %s, want 3s from the settings directory", o.Timeout)
+	}
+	if o.TopPeers != 12 {
+		t.Errorf("top = %d, want 12 from the command line over the file", o.TopPeers)
+	}
+
+	writeSettings(t, dir, map[string]string{"top": "many"})
+	if _, err := parseFlags([]string{"-settings-dir", dir}); err == nil {
+		t.Error("an invalid top setting was accepted")
+	}
+}
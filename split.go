@@ -0,0 +1,36 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// directionPath returns the name of the file for one direction of path,
+// e.g. peers-in.txt for peers.txt and dir "in".
+func directionPath(path, dir string) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), dir, ext)
+}
+
+// writeSplitDirection writes the inbound and outbound peers of res to
+// their own files next to opts.outputFile, in the same format and
+// encoding.
+func writeSplitDirection(res *peerfilter.Result, opts options) error {
+	for _, dir := range []struct {
+		name     string
+		outbound bool
+	}{{"in", false}, {"out", true}} {
+		path := directionPath(opts.outputFile, dir.name)
+		out, err := peerfilter.Format(res.Direction(dir.outbound), opts.Options)
+		if err != nil {
+			return fmt.Errorf("error formatting %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+			return wrapWriteError("result file", path, err)
+		}
+	}
+	return nil
+}
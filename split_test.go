@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitDirection(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "peers.txt")
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(5)), "-output-file", out, "-split-direction")
+	if err := run(opts); err != nil {
+		t.Fatal(err)
+	}
+	// testPeers makes the odd peers outbound.
+	for path, want := range map[string][]int{
+		out: {1, 2, 3, 4, 5},
+		filepath.Join(filepath.Dir(out), "peers-in.txt"):  {2, 4},
+		filepath.Join(filepath.Dir(out), "peers-out.txt"): {1, 3, 5},
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := make([]string, len(want))
+		for i, n := range want {
+			entries[i] = testPeerEntry(n)
+		}
+		if got := string(data); got != strings.Join(entries, ",") {
+			t.Errorf("%s = %q, want peers %v", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func TestDirectionPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/etc/peers.txt": "/etc/peers-in.txt",
+		"peers":          "peers-in",
+		"a.b/peers.json": "a.b/peers-in.json",
+	} {
+		if got := directionPath(path, "in"); got != want {
+			t.Errorf("directionPath(%q, \"in\") = %q, want %q", path, got, want)
+		}
+	}
+}
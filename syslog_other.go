@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// setupSyslog is unavailable on platforms without log/syslog.
+func setupSyslog(facility, tag string) error {
+	return errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,46 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetupSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	syslogNetwork, syslogAddr = "udp", conn.LocalAddr().String()
+	t.Cleanup(func() {
+		syslogNetwork, syslogAddr = "", ""
+		log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+		log.SetOutput(os.Stderr)
+	})
+
+	if err := setupSyslog("local3", "peer-filter"); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("hello from the test")
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(buf[:n])
+	if !strings.Contains(line, "peer-filter") || !strings.Contains(line, "hello from the test") {
+		t.Errorf("syslog received %q, want the tag and the message", line)
+	}
+
+	if err := setupSyslog("nosuch", "peer-filter"); err == nil {
+		t.Error("setupSyslog accepted an unknown facility")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"fmt"
+	"os"
+)
+
+// appendTimeSeries appends a row per selected peer of res to the CSV file
+// at path, writing the header first if the file is new or empty.
+func appendTimeSeries(path string, res *peerfilter.Result, opts peerfilter.Options) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return wrapWriteError("time series", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading time series %s: %w", path, err)
+	}
+	rows, err := peerfilter.FormatTimeSeries(res, opts, info.Size() == 0)
+	if err != nil {
+		return fmt.Errorf("error formatting time series: %w", err)
+	}
+	if _, err := f.WriteString(rows); err != nil {
+		return wrapWriteError("time series", path, err)
+	}
+	return f.Close()
+}
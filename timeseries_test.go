@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeSeriesAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.csv")
+	// The timestamps have a resolution of a second, so the runs are a
+	// second apart to tell them apart.
+	opts := testOptions(t, "-host", serveNetInfo(t, testPeers(2)), "-interval", "1s", "-timeseries-csv", path)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDaemon(opts, stop)
+		close(done)
+	}()
+
+	var rows [][]string
+	deadline := time.Now().Add(10 * time.Second)
+	for len(rows) < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d rows, want a header and 2 rows for each of 2 runs", path, len(rows))
+		}
+		time.Sleep(50 * time.Millisecond)
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			continue
+		}
+		if rows, err = csv.NewReader(strings.NewReader(string(data))).ReadAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-done
+
+	if rows[0][0] != "timestamp" || rows[0][1] != "rank" {
+		t.Errorf("header %q, want timestamp and rank first", rows[0])
+	}
+	first, second := rows[1][0], rows[3][0]
+	if rows[2][0] != first || rows[4][0] != second || first == second {
+		t.Errorf("timestamps %s %s %s %s, want two rows each for two runs", rows[1][0], rows[2][0], rows[3][0], rows[4][0])
+	}
+	for _, ts := range []string{first, second} {
+		if _, err := time.Parse(time.RFC3339, ts); err != nil {
+			t.Errorf("invalid timestamp: %v", err)
+		}
+	}
+	for i, want := range []string{"1", "2", "1", "2"} {
+		if rows[i+1][1] != want {
+			t.Errorf("row %d has rank %s, want %s", i+1, rows[i+1][1], want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cometbft-peer-filter/peerfilter"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// validateFile checks every entry of an existing result file, written
+// with the given -output-encoding, without fetching net_info, logging
+// each invalid one. With dial, valid entries
+// must also accept a TCP connection within timeout, and failMemory, if
+// set, records the outcome of each dial. It fails if any entry is
+// invalid.
+func validateFile(path, encoding string, dial bool, timeout time.Duration, failMemory *peerfilter.FailMemory) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	text, err := peerfilter.DecodeOutput(string(data), encoding)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	entries := peerfilter.ParseEntries(text)
+	if dial && failMemory != nil {
+		if err := failMemory.Load(); err != nil {
+			return err
+		}
+	}
+	invalid := 0
+	for _, entry := range entries {
+		addr, err := peerfilter.ValidateEntry(entry)
+		if err == nil && dial {
+			var conn net.Conn
+			if conn, err = net.DialTimeout("tcp", addr, timeout); err == nil {
+				conn.Close()
+			}
+			if failMemory != nil {
+				failMemory.Record(entryNodeID(entry), err != nil, time.Now())
+			}
+		}
+		if err != nil {
+			log.Errorf("Invalid entry %s: %v", entry, err)
+			invalid++
+		}
+	}
+
+	if dial && failMemory != nil {
+		if err := failMemory.Save(time.Now()); err != nil {
+			return err
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d entries in %s are invalid", invalid, len(entries), path)
+	}
+	log.Infof("All %d entries in %s are valid", len(entries), path)
+	return nil
+}
+
+// entryNodeID returns the node ID of a valid [scheme://]id@host:port
+// entry.
+func entryNodeID(entry string) string {
+	if i := strings.Index(entry, "://"); i >= 0 {
+		entry = entry[i+3:]
+	}
+	id, _, _ := strings.Cut(entry, "@")
+	return id
+}
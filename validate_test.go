@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus/hooks/test"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateFile(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	valid := strings.Repeat("a", 40) + "@" + lis.Addr().String()
+	invalid := "not-a-node-id@10.0.0.2:26656"
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	err = validateFile(write("mixed.txt", valid+","+invalid), "raw", false, time.Second, nil)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 entries") {
+		t.Errorf("one valid and one invalid entry: err = %v, want 1 of 2 invalid", err)
+	}
+	var reported []string
+	for _, e := range hook.AllEntries() {
+		if strings.HasPrefix(e.Message, "Invalid entry") {
+			reported = append(reported, e.Message)
+		}
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0], invalid) {
+		t.Errorf("reported %q, want only %s", reported, invalid)
+	}
+
+	if err := validateFile(write("valid.txt", valid), "raw", true, time.Second, nil); err != nil {
+		t.Errorf("a reachable valid entry: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"time"
+)
+
+// watchFile calls fn each time the file at path is written, created or
+// touched. Bursts of events within debounce are coalesced into a single
+// call. The parent directory is watched so the trigger file may be replaced
+// or created after startup. watchFile blocks until the watcher fails.
+func watchFile(path string, debounce time.Duration, fn func()) error {
+	path = filepath.Clean(path)
+	return watch(filepath.Dir(path), func(event fsnotify.Event) bool {
+		return filepath.Clean(event.Name) == path &&
+			(event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Chmod))
+	}, debounce, fn)
+}
+
+// watchDir calls fn each time an entry of dir changes, coalescing bursts
+// within debounce. This also catches the atomic symlink swap Kubernetes
+// uses to update a mounted ConfigMap. watchDir blocks until the watcher
+// fails.
+func watchDir(dir string, debounce time.Duration, fn func()) error {
+	return watch(dir, func(fsnotify.Event) bool { return true }, debounce, fn)
+}
+
+// watch calls fn after debounce once events in dir accepted by match stop
+// arriving.
+func watch(dir string, match func(fsnotify.Event) bool, debounce time.Duration, fn func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if match(event) {
+				pending = time.After(debounce)
+			}
+		case <-pending:
+			pending = nil
+			fn()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
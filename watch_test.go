@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	trigger := filepath.Join(dir, "trigger")
+	fired := make(chan struct{}, 1)
+	go watchFile(trigger, 10*time.Millisecond, func() {
+		select {
+		case fired <- struct{}{}:
+		default:
+		}
+	})
+
+	// The watcher starts asynchronously, so keep touching the trigger file
+	// until a run happens.
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-fired:
+			return
+		case <-tick.C:
+			if err := os.WriteFile(trigger, []byte(time.Now().String()), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		case <-deadline:
+			t.Fatal("writing the trigger file did not start a run")
+		}
+	}
+}